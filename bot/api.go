@@ -0,0 +1,384 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"euphoria.io/adbot/sys"
+	"euphoria.io/heim/proto"
+)
+
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func apiErrorf(status int, format string, args ...interface{}) error {
+	return &apiError{status, fmt.Sprintf(format, args...)}
+}
+
+type APIHandler func(caller *Caller, r *http.Request, args []string) (interface{}, error)
+
+type API struct {
+	Bot *Bot
+}
+
+func (api *API) authenticate(r *http.Request) (*Caller, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return nil, apiErrorf(http.StatusUnauthorized, "missing bearer token")
+	}
+	adminToken := api.Bot.Config.APIToken
+	if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+		return &Caller{UserID: sys.House, Host: true}, nil
+	}
+	t, err := sys.LookupToken(api.Bot.DB, token)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, apiErrorf(http.StatusUnauthorized, "invalid token")
+	}
+	return &Caller{UserID: t.UserID, Account: true}, nil
+}
+
+func (api *API) route(method string, path []string) (APIHandler, []string) {
+	match := func(pattern ...string) ([]string, bool) {
+		if len(pattern) != len(path) {
+			return nil, false
+		}
+		args := []string{}
+		for i, part := range pattern {
+			switch part {
+			case "*":
+				args = append(args, path[i])
+			case path[i]:
+			default:
+				return nil, false
+			}
+		}
+		return args, true
+	}
+
+	routes := []struct {
+		method  string
+		pattern []string
+		handler APIHandler
+	}{
+		{"GET", []string{"rooms"}, api.listRooms},
+		{"POST", []string{"rooms", "*", "join"}, api.joinRoom},
+		{"POST", []string{"rooms", "*", "part"}, api.partRoom},
+		{"GET", []string{"campaigns"}, api.listCampaigns},
+		{"GET", []string{"advertisers", "*"}, api.getAdvertiser},
+		{"POST", []string{"advertisers", "*", "credit"}, api.credit},
+		{"GET", []string{"advertisers", "*", "ledger"}, api.ledger},
+		{"POST", []string{"advertisers", "*", "enable"}, api.setUserEnabled},
+		{"POST", []string{"advertisers", "*", "disable"}, api.setUserEnabled},
+		{"GET", []string{"advertisers", "*", "creatives"}, api.listCreatives},
+		{"PUT", []string{"advertisers", "*", "creatives", "*"}, api.putCreative},
+		{"DELETE", []string{"advertisers", "*", "creatives", "*"}, api.deleteCreative},
+		{"GET", []string{"advertisers", "*", "spends"}, api.listSpends},
+		{"PUT", []string{"advertisers", "*", "spends", "*"}, api.putSpend},
+		{"DELETE", []string{"advertisers", "*", "spends", "*"}, api.deleteSpend},
+		{"POST", []string{"advertisers", "*", "spends", "*", "enable"}, api.setSpendEnabled},
+		{"POST", []string{"advertisers", "*", "spends", "*", "disable"}, api.setSpendEnabled},
+	}
+	for _, route := range routes {
+		if route.method != method {
+			continue
+		}
+		if args, ok := match(route.pattern...); ok {
+			return route.handler, args
+		}
+	}
+	return nil, nil
+}
+
+func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result, err := api.serve(r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if apiErr, ok := err.(*apiError); ok {
+			status = apiErr.status
+		}
+		w.WriteHeader(status)
+		result = map[string]string{"Error": err.Error()}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		fmt.Printf("error writing api response: %s\n", err)
+	}
+}
+
+func (api *API) serve(r *http.Request) (interface{}, error) {
+	caller, err := api.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	handler, args := api.route(r.Method, path)
+	if handler == nil {
+		return nil, apiErrorf(http.StatusNotFound, "no such endpoint: %s %s", r.Method, r.URL.Path)
+	}
+	return handler(caller, r, args)
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return apiErrorf(http.StatusBadRequest, "invalid request body: %s", err)
+	}
+	return nil
+}
+
+func (api *API) requireHost(caller *Caller) error {
+	if !caller.Host {
+		return apiErrorf(http.StatusForbidden, "permission denied")
+	}
+	return nil
+}
+
+func (api *API) advertiser(caller *Caller, userID string) (proto.UserID, error) {
+	if !caller.Host && proto.UserID(userID) != caller.UserID {
+		return "", apiErrorf(http.StatusForbidden, "permission denied")
+	}
+	return proto.UserID(userID), nil
+}
+
+func (api *API) listRooms(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	rooms, err := sys.Rooms(api.Bot.DB)
+	if err != nil {
+		return nil, err
+	}
+	if rooms == nil {
+		rooms = []string{}
+	}
+	return rooms, nil
+}
+
+func (api *API) joinRoom(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	joined, err := api.Bot.Join(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"Joined": joined}, nil
+}
+
+func (api *API) partRoom(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	parted, err := api.Bot.Part(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"Parted": parted}, nil
+}
+
+func (api *API) listCampaigns(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if !caller.Host {
+		return sys.Spends(api.Bot.DB, caller.UserID)
+	}
+	spends := []sys.Spend{}
+	err := sys.MapSpends(api.Bot.DB, func(spend sys.Spend) error {
+		spends = append(spends, spend)
+		return nil
+	})
+	return spends, err
+}
+
+func (api *API) getAdvertiser(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	adv, err := sys.GetAdvertiser(api.Bot.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		UserID proto.UserID
+		*sys.Advertiser
+	}{userID, adv}, nil
+}
+
+func (api *API) credit(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	req := struct {
+		Cents sys.Cents
+		Memo  string
+	}{}
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Cents <= 0 {
+		return nil, apiErrorf(http.StatusBadRequest, "credit must be positive")
+	}
+	userID := proto.UserID(args[0])
+	_, balance, err := sys.Transfer(api.Bot.DB, req.Cents, sys.House, userID, req.Memo, true)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]sys.Cents{"Balance": balance}, nil
+}
+
+func (api *API) ledger(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	limit := 25
+	if str := r.URL.Query().Get("limit"); str != "" {
+		if limit, err = strconv.Atoi(str); err != nil || limit < 1 || limit > 1000 {
+			return nil, apiErrorf(http.StatusBadRequest, "invalid limit: %s", str)
+		}
+	}
+	filter := sys.LedgerFilter{UserID: userID}
+	entries, more, err := sys.QueryLedger(api.Bot.DB, filter, r.URL.Query().Get("before"), limit)
+	if err != nil {
+		return nil, err
+	}
+	page := struct {
+		Entries []sys.LedgerEntry
+		Next    string `json:",omitempty"`
+	}{Entries: entries}
+	if more {
+		page.Next = entries[0].TxID.String()
+	}
+	return page, nil
+}
+
+func (api *API) setUserEnabled(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	enabled := strings.HasSuffix(r.URL.Path, "/enable")
+	if err := sys.SetUserEnabled(api.Bot.DB, proto.UserID(args[0]), enabled); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"Enabled": enabled}, nil
+}
+
+func (api *API) setSpendEnabled(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	if err := api.requireHost(caller); err != nil {
+		return nil, err
+	}
+	enabled := strings.HasSuffix(r.URL.Path, "/enable")
+	if err := sys.SetSpendEnabled(api.Bot.DB, proto.UserID(args[0]), args[1], enabled); err != nil {
+		return nil, err
+	}
+	return map[string]bool{"Enabled": enabled}, nil
+}
+
+func (api *API) listCreatives(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return sys.Creatives(api.Bot.DB, userID)
+}
+
+func (api *API) putCreative(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	req := struct{ Content string }{}
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	if req.Content == "" {
+		return nil, apiErrorf(http.StatusBadRequest, "missing content")
+	}
+	creative, replaced, err := sys.NewCreative(api.Bot.DB, userID, args[1], req.Content)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		*sys.Creative
+		Replaced bool
+	}{creative, replaced}, nil
+}
+
+func (api *API) deleteCreative(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := sys.DeleteCreative(api.Bot.DB, userID, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, apiErrorf(http.StatusNotFound, "no such creative: %s", args[1])
+	}
+	return map[string]bool{"Deleted": true}, nil
+}
+
+func (api *API) listSpends(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return sys.Spends(api.Bot.DB, userID)
+}
+
+func (api *API) putSpend(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	req := struct {
+		sys.Spend
+		Targeting string
+	}{}
+	if err := decodeBody(r, &req); err != nil {
+		return nil, err
+	}
+	spend := req.Spend
+	if len(spend.Keywords) > 0 || len(spend.Phrases) > 0 || len(spend.Negative) > 0 {
+		return nil, apiErrorf(http.StatusBadRequest, "set Targeting instead of Keywords, Phrases or Negative")
+	}
+	spend.UserID = userID
+	spend.CreativeName = args[1]
+	spend.Keywords, spend.Phrases, spend.Negative = sys.ParseKeywords(req.Targeting)
+	if err := spend.Validate(); err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, "%s", err)
+	}
+	replaced, err := sys.NewSpend(api.Bot.DB, &spend)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		sys.Spend
+		Replaced bool
+	}{spend, replaced}, nil
+}
+
+func (api *API) deleteSpend(caller *Caller, r *http.Request, args []string) (interface{}, error) {
+	userID, err := api.advertiser(caller, args[0])
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := sys.DeleteSpend(api.Bot.DB, userID, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, apiErrorf(http.StatusNotFound, "no spend on creative %s", args[1])
+	}
+	return map[string]bool{"Deleted": true}, nil
+}
@@ -1,35 +1,78 @@
 package bot
 
 import (
+	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"euphoria.io/scope"
 
 	"euphoria.io/adbot/sys"
+	"euphoria.io/heim/proto"
 )
 
+const StimulusInterval = time.Minute
+
 func New(cfg *Config) (*Bot, error) {
+	auctioneer, err := sys.NewAuctioneer(cfg.Auction, cfg.AuctionSlots)
+	if err != nil {
+		return nil, err
+	}
+
+	var creativeCap sys.FrequencyCap
+	if cfg.CreativeCap != "" {
+		creativeCap, err = ParseFrequencyCap(cfg.CreativeCap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid creative cap: %s", err)
+		}
+	}
+
+	var confirmAbove sys.Cents
+	if cfg.ConfirmAbove != "" {
+		confirmAbove, err = ParseCents(cfg.ConfirmAbove)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transfer confirmation threshold: %s", err)
+		}
+	}
+
 	db, err := sys.Open(cfg.DBPath)
 	if err != nil {
 		return nil, err
 	}
+	db.Auctioneer = auctioneer
+	db.CreativeCap = creativeCap
+	db.RoomCap = cfg.RoomCap
 
 	bot := &Bot{
-		Config: cfg,
-		DB:     db,
+		Config:       cfg,
+		DB:           db,
+		confirmAbove: confirmAbove,
 	}
+	bot.Monitor = NewMonitor(bot)
+	db.OnPause = bot.notifyPaused
+	db.OnSelect = logSelect
 	return bot, nil
 }
 
+func logSelect(roomName string, words []string, minBid sys.Cents, selections []sys.Selection) {
+	fmt.Printf("auctioning %s in &%s at min bid %s\n", strings.Join(words, ", "), roomName, minBid)
+	for _, selection := range selections {
+		fmt.Printf("selecting %s at %s\n", selection.Creative.Name, selection.Cost)
+	}
+}
+
 type Bot struct {
 	sync.Mutex
-	Config *Config
-	DB     *sys.DB
-
-	ctx       scope.Context
-	ctrlRooms map[string]*Room
-	rooms     map[string]*Room
+	Config  *Config
+	DB      *sys.DB
+	Monitor *Monitor
+
+	ctx          scope.Context
+	ctrlRooms    map[string]*Room
+	rooms        map[string]*Room
+	confirmAbove sys.Cents
+	transfers    pendingTransfers
 }
 
 func (b *Bot) NewRoom(roomName string) *Room {
@@ -70,6 +113,7 @@ func (b *Bot) Serve(ctx scope.Context) error {
 		}
 	}
 
+	go b.runStimulus(b.ctx.Fork())
 	return nil
 }
 
@@ -112,3 +156,54 @@ func (b *Bot) Part(roomName string) (bool, error) {
 
 	return sys.Part(b.DB, roomName)
 }
+
+func (b *Bot) MinBid(roomName string) (sys.Cents, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	room, ok := b.rooms[strings.ToLower(roomName)]
+	if !ok {
+		return 0, false
+	}
+	ish, ok := room.SpeechHandler.(*InventorySpeechHandler)
+	if !ok {
+		return 0, false
+	}
+	return ish.MinBid(), true
+}
+
+func (b *Bot) notify(content string) {
+	for _, room := range b.ctrlRooms {
+		if room.Connected() {
+			room.c.AsyncSend(proto.SendType, proto.Message{Content: content})
+		}
+	}
+}
+
+func (b *Bot) notifyPaused(userID proto.UserID, paused bool, balance, limit sys.Cents) {
+	if paused {
+		b.notify(fmt.Sprintf("/me paused all spends by %s: balance of %s has reached the credit limit of %s", userID, balance, limit))
+	} else {
+		b.notify(fmt.Sprintf("/me resumed spends by %s: balance of %s is back within the credit limit of %s", userID, balance, limit))
+	}
+}
+
+func (b *Bot) runStimulus(ctx scope.Context) {
+	ticker := time.NewTicker(StimulusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ran, err := sys.RunStimulus(b.DB)
+			if err != nil {
+				fmt.Printf("error running scheduled stimulus: %s\n", err)
+				continue
+			}
+			for _, s := range ran {
+				b.notify(fmt.Sprintf("/me rolled out scheduled stimulus %s (%s)", s.ID, &s))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
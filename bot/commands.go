@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"euphoria.io/adbot/sys"
 	"euphoria.io/heim/proto"
@@ -174,3 +175,76 @@ func ParseCents(str string) (sys.Cents, error) {
 	}
 	return sys.Cents(f * 100), nil
 }
+
+func ParseRooms(str string) []string { return sys.NormalizeRooms(strings.Split(str, ",")) }
+
+func ParseFrequencyCap(str string) (sys.FrequencyCap, error) {
+	parts := strings.SplitN(str, "/", 2)
+	if len(parts) != 2 {
+		return sys.FrequencyCap{}, fmt.Errorf("expected COUNT/WINDOW, e.g. 3/1h")
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return sys.FrequencyCap{}, err
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return sys.FrequencyCap{}, err
+	}
+	if count < 1 || window <= 0 {
+		return sys.FrequencyCap{}, fmt.Errorf("count and window must be positive")
+	}
+	if window > sys.MaxFrequencyWindow {
+		return sys.FrequencyCap{}, fmt.Errorf("window can't be longer than %s", sys.MaxFrequencyWindow)
+	}
+	return sys.FrequencyCap{Count: count, Window: window}, nil
+}
+
+func ParseDate(str string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04", str, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", str, loc)
+	if err != nil {
+		return t, fmt.Errorf("expected YYYY-MM-DD or YYYY-MM-DDTHH:MM")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func ParseDuration(str string) (time.Duration, error) {
+	if n := len(str); n > 1 && (str[n-1] == 'd' || str[n-1] == 'w') {
+		count, err := strconv.Atoi(str[:n-1])
+		if err != nil {
+			return 0, err
+		}
+		days := count
+		if str[n-1] == 'w' {
+			days *= 7
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(str)
+}
+
+func ParseCreatives(str string) ([]sys.WeightedCreative, error) {
+	creatives := []sys.WeightedCreative{}
+	for _, part := range strings.Split(str, ",") {
+		wc := sys.WeightedCreative{Name: part, Weight: 1}
+		if idx := strings.Index(part, "="); idx >= 0 {
+			weight, err := strconv.ParseFloat(part[idx+1:], 64)
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight for %s", part[:idx])
+			}
+			wc.Name = part[:idx]
+			wc.Weight = weight
+		}
+		if wc.Name == "" {
+			return nil, fmt.Errorf("missing creative name")
+		}
+		creatives = append(creatives, wc)
+	}
+	return creatives, nil
+}
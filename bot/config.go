@@ -5,24 +5,42 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"euphoria.io/adbot/sys"
 )
 
 type Config struct {
+	APIToken     string
+	Auction      string
+	AuctionSlots int
 	BaseURL      string
 	ControlRooms string
+	ConfirmAbove string
+	CreativeCap  string
 	DBPath       string
 	DefaultNick  string
+	ExportDir    string
 	Ghost        bool
+	HTTPAddr     string
+	RoomCap      int
 }
 
 func (cfg *Config) FlagSet() *flag.FlagSet {
 	cmdName := filepath.Base(os.Args[0])
 	flags := flag.NewFlagSet(cmdName, flag.ContinueOnError)
+	flags.StringVar(&cfg.APIToken, "apiToken", os.Getenv("ADBOT_API_TOKEN"), "bearer token granting admin access to the HTTP API under /api/")
+	flags.StringVar(&cfg.Auction, "auction", sys.SecondPriceAuction, "auction mechanism: second-price, first-price, or gsp")
+	flags.IntVar(&cfg.AuctionSlots, "slots", 1, "number of ads placed per message by the gsp auction")
 	flags.StringVar(&cfg.BaseURL, "baseURL", "https://euphoria.io", "base websocket URL for euphoria")
 	flags.StringVar(&cfg.ControlRooms, "controlRoom", "ads", "name of room where admin commands are given (or comma-separated list)")
+	flags.StringVar(&cfg.ConfirmAbove, "confirmTransfer", "$20", "transfers between advertisers above this amount must be confirmed with !transfer confirm")
+	flags.StringVar(&cfg.CreativeCap, "creativeCap", "", "default limit on deliveries of one creative per room, as COUNT/WINDOW (e.g. 3/1h)")
 	flags.StringVar(&cfg.DBPath, "db", "adbot.db", "path to database file")
 	flags.StringVar(&cfg.DefaultNick, "defaultNick", "Adbot", "name to use in control room")
+	flags.StringVar(&cfg.ExportDir, "exportDir", "exports", "directory where !export writes ledger exports")
 	flags.BoolVar(&cfg.Ghost, "ghost", false, "connect to inventory rooms in ghost mode, where the bot and ads remain hidden")
+	flags.StringVar(&cfg.HTTPAddr, "http", "", "address to serve /metrics, /healthz and /api/ on, e.g. :8080 (disabled if empty)")
+	flags.IntVar(&cfg.RoomCap, "roomCap", 0, "maximum number of sponsored messages per room per hour (0 for no limit)")
 	flags.Usage = func() {
 		fmt.Printf("usage: %s OPTIONS\n\n", cmdName)
 		flags.PrintDefaults()
@@ -3,9 +3,13 @@ package bot
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"euphoria.io/adbot/sys"
 	"euphoria.io/heim/proto"
@@ -15,15 +19,104 @@ type ControlRoomCommands struct {
 	GeneralCommands
 }
 
+func (c *ControlRoomCommands) CmdAdminAuction(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	recentAuctions := func(roomName string) error {
+		records, err := sys.Auctions(c.Bot.DB, roomName, 10)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if len(records) == 0 {
+			return reply("no auctions")
+		}
+		buf := &bytes.Buffer{}
+		fmt.Fprintln(buf, "recent auctions:")
+		w := TabWriter(buf)
+		fmt.Fprintln(w, "ID\tTime\tRoom\tMin Bid\tBids\tWinners\t")
+		for _, record := range records {
+			winners := []string{}
+			for _, award := range record.Awards {
+				winners = append(winners, fmt.Sprintf("%s@%s", award.CreativeName, award.Cost))
+			}
+			fmt.Fprintf(w, "%s\t%s\t&%s\t%s\t%d\t%s\t\n",
+				record.ID, record.Time.UTC().Format("2006-01-02 15:04:05"), record.Room, record.MinBid, len(record.Bids), strings.Join(winners, ","))
+		}
+		w.Flush()
+		return reply(buf.String())
+	}
+
+	auction := func(id string) error {
+		record, err := sys.GetAuction(c.Bot.DB, id)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if record == nil {
+			return reply("auction %s not found", id)
+		}
+		buf := &bytes.Buffer{}
+		fmt.Fprintf(buf, "auction %s in &%s at %s, min bid %s\n",
+			record.ID, record.Room, record.Time.UTC().Format("2006-01-02 15:04:05"), record.MinBid)
+		fmt.Fprintf(buf, "words: %s\n", strings.Join(record.Words, " "))
+		if record.Skipped != "" {
+			fmt.Fprintf(buf, "skipped: %s\n", record.Skipped)
+		}
+		w := TabWriter(buf)
+		fmt.Fprintln(w, "Account\tCreative\tMatches\tDiscount\tMax Bid\tBid\tOutcome\t")
+		for _, bid := range record.Bids {
+			_, id := bid.UserID.Parse()
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.3f\t%s\t%s\t%s\t\n",
+				id, bid.CreativeName, strings.Join(bid.Matches, ","), bid.Discount, bid.MaxBid, bid.Bid, bid.Outcome)
+		}
+		w.Flush()
+		for _, award := range record.Awards {
+			fmt.Fprintf(buf, "%s charged %s for %s (tx %s)\n", award.UserID, award.Cost, award.CreativeName, award.TxID)
+		}
+		return reply(buf.String())
+	}
+
+	switch len(cmd.Args) {
+	case 0:
+		return recentAuctions("")
+	case 1:
+		if strings.HasPrefix(cmd.Args[0], "&") {
+			return recentAuctions(strings.ToLower(strings.TrimPrefix(cmd.Args[0], "&")))
+		}
+		return auction(cmd.Args[0])
+	default:
+		return reply("usage: !auction [ID|&ROOM]")
+	}
+}
+
+func (c *ControlRoomCommands) CmdAdminAudit(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	report, err := sys.Audit(c.Bot.DB)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	buf := &bytes.Buffer{}
+	WriteAuditReport(buf, report, 20)
+	return reply(buf.String())
+}
+
 func (c *ControlRoomCommands) CmdAdminCampaign(caller *Caller, cmd *Command, reply ReplyFunc) error {
-	fmtKeywords := func(keywords sys.WordList) string {
+	fmtKeywords := func(spend sys.Spend) string {
 		buf := &bytes.Buffer{}
-		for k, _ := range keywords {
+		for k, _ := range spend.Keywords {
 			if buf.Len() > 0 {
 				buf.WriteRune(',')
 			}
 			buf.WriteString(k)
 		}
+		for _, phrase := range spend.Phrases {
+			if buf.Len() > 0 {
+				buf.WriteRune(',')
+			}
+			buf.WriteString(phrase.String())
+		}
+		for k, _ := range spend.Negative {
+			if buf.Len() > 0 {
+				buf.WriteRune(',')
+			}
+			buf.WriteString("-" + k)
+		}
 		keywordString := buf.String()
 		if len(keywordString) > 50 {
 			keywordString = keywordString[:50] + "..."
@@ -31,19 +124,116 @@ func (c *ControlRoomCommands) CmdAdminCampaign(caller *Caller, cmd *Command, rep
 		return keywordString
 	}
 
+	fmtRooms := func(spend sys.Spend) string {
+		rooms := []string{}
+		for _, roomName := range spend.Rooms {
+			rooms = append(rooms, "&"+roomName)
+		}
+		for _, roomName := range spend.ExcludeRooms {
+			rooms = append(rooms, "!&"+roomName)
+		}
+		if len(rooms) == 0 {
+			return "-"
+		}
+		return strings.Join(rooms, ",")
+	}
+
+	fmtCreative := func(spend sys.Spend) string {
+		if len(spend.Creatives) == 0 {
+			return spend.CreativeName
+		}
+		parts := []string{}
+		for _, wc := range spend.Creatives {
+			parts = append(parts, fmt.Sprintf("%s=%g", wc.Name, wc.Weight))
+		}
+		return fmt.Sprintf("%s (%s)", strings.Join(parts, ","), spend.Rotation)
+	}
+
+	fmtFrequency := func(spend sys.Spend) string {
+		if spend.FrequencyCap == nil {
+			return "-"
+		}
+		return spend.FrequencyCap.String()
+	}
+
+	fmtWhen := func(spend sys.Spend) (string, error) {
+		if spend.Start == nil && spend.End == nil && spend.Schedule == nil {
+			return "-", nil
+		}
+		loc, err := sys.GetLocation(c.Bot.DB, spend.UserID)
+		if err != nil {
+			return "", err
+		}
+		parts := []string{}
+		if spend.Start != nil || spend.End != nil {
+			start, end := "", ""
+			if spend.Start != nil {
+				start = spend.Start.In(loc).Format("2006-01-02T15:04")
+			}
+			if spend.End != nil {
+				end = spend.End.In(loc).Format("2006-01-02T15:04")
+			}
+			parts = append(parts, start+".."+end)
+		}
+		if spend.Schedule != nil {
+			parts = append(parts, spend.Schedule.String())
+		}
+		return strings.Join(parts, " "), nil
+	}
+
+	fmtMaxBid := func(spend sys.Spend) string {
+		if spend.Billing != sys.EngagementBilling {
+			return spend.MaxBid.String()
+		}
+		if spend.EngagementCap > 0 {
+			return fmt.Sprintf("%s/eng (max %d)", spend.MaxBid, spend.EngagementCap)
+		}
+		return fmt.Sprintf("%s/eng", spend.MaxBid)
+	}
+
+	fmtCaps := func(spend sys.Spend) (string, string, error) {
+		if spend.DailyCap == 0 && spend.LifetimeCap == 0 {
+			return "-", "-", nil
+		}
+		usage, err := sys.GetBudgetUsage(c.Bot.DB, spend.UserID, spend.CreativeName)
+		if err != nil {
+			return "", "", err
+		}
+		daily, lifetime := "-", "-"
+		if spend.DailyCap > 0 {
+			daily = fmt.Sprintf("%s/%s", usage.Daily, spend.DailyCap)
+		}
+		if spend.LifetimeCap > 0 {
+			lifetime = fmt.Sprintf("%s/%s", usage.Lifetime, spend.LifetimeCap)
+		}
+		return daily, lifetime, nil
+	}
+
 	allCampaigns := func() error {
-		buf := &bytes.Buffer{}
-		fmt.Fprintln(buf, "all campaigns:")
-		w := TabWriter(buf)
-		fmt.Fprintln(w, "Account\tCreative\tMax Bid\tKeywords\t")
+		spends := []sys.Spend{}
 		err := sys.MapSpends(c.Bot.DB, func(spend sys.Spend) error {
-			_, id := spend.UserID.Parse()
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", id, spend.CreativeName, spend.MaxBid, fmtKeywords(spend.Keywords))
+			spends = append(spends, spend)
 			return nil
 		})
 		if err != nil {
 			return reply("error: %s", err)
 		}
+		buf := &bytes.Buffer{}
+		fmt.Fprintln(buf, "all campaigns:")
+		w := TabWriter(buf)
+		fmt.Fprintln(w, "Account\tCreative\tMax Bid\tDaily\tLifetime\tFreq\tWhen\tRooms\tKeywords\t")
+		for _, spend := range spends {
+			daily, lifetime, err := fmtCaps(spend)
+			if err != nil {
+				return reply("error: %s", err)
+			}
+			when, err := fmtWhen(spend)
+			if err != nil {
+				return reply("error: %s", err)
+			}
+			_, id := spend.UserID.Parse()
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", id, fmtCreative(spend), fmtMaxBid(spend), daily, lifetime, fmtFrequency(spend), when, fmtRooms(spend), fmtKeywords(spend))
+		}
 		w.Flush()
 		return reply(buf.String())
 	}
@@ -57,9 +247,17 @@ func (c *ControlRoomCommands) CmdAdminCampaign(caller *Caller, cmd *Command, rep
 		buf := &bytes.Buffer{}
 		fmt.Fprintf(buf, "%s campaigns\n", userID)
 		w := TabWriter(buf)
-		fmt.Fprintln(w, "Creative\tMax Bid\tKeywords\t")
+		fmt.Fprintln(w, "Creative\tMax Bid\tDaily\tLifetime\tFreq\tWhen\tRooms\tKeywords\t")
 		for _, spend := range spends {
-			fmt.Fprintf(w, "%s\t%s\t%s\t\n", spend.CreativeName, spend.MaxBid, fmtKeywords(spend.Keywords))
+			daily, lifetime, err := fmtCaps(spend)
+			if err != nil {
+				return reply("error: %s", err)
+			}
+			when, err := fmtWhen(spend)
+			if err != nil {
+				return reply("error: %s", err)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", fmtCreative(spend), fmtMaxBid(spend), daily, lifetime, fmtFrequency(spend), when, fmtRooms(spend), fmtKeywords(spend))
 		}
 		w.Flush()
 		return reply(buf.String())
@@ -130,6 +328,105 @@ func (c *ControlRoomCommands) setEnabled(caller *Caller, cmd *Command, reply Rep
 	}
 }
 
+func (c *ControlRoomCommands) CmdAdminExplain(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	if len(cmd.Args) < 1 {
+		return reply("usage: !explain TEXT [&ROOM]")
+	}
+
+	text := cmd.Rest(1)
+	roomName := ""
+	minBid := sys.Cents(0)
+	if last := cmd.Args[len(cmd.Args)-1]; len(cmd.Args) > 1 && strings.HasPrefix(last, "&") {
+		text = strings.TrimSpace(strings.TrimSuffix(text, last))
+		roomName = strings.ToLower(strings.TrimPrefix(last, "&"))
+		var ok bool
+		minBid, ok = c.Bot.MinBid(roomName)
+		if !ok {
+			return reply("not tracking &%s", roomName)
+		}
+	}
+
+	explanations, err := sys.Explain(c.Bot.DB, roomName, text, minBid)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	if len(explanations) == 0 {
+		return reply("no spends to consider")
+	}
+
+	buf := &bytes.Buffer{}
+	if roomName == "" {
+		fmt.Fprintf(buf, "auction with no room at min bid %s:\n", minBid)
+	} else {
+		fmt.Fprintf(buf, "auction in &%s at min bid %s:\n", roomName, minBid)
+	}
+	w := TabWriter(buf)
+	fmt.Fprintln(w, "Account\tCreative\tMatches\tScore\tDiscount\tMax Bid\tBid\tOutcome\t")
+	for _, e := range explanations {
+		_, id := e.UserID.Parse()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.3f\t%.3f\t%s\t%s\t%s\t\n",
+			id, e.CreativeName, e.Matches, e.Score, e.Discount, e.MaxBid, e.Bid.Bid, e.Outcome)
+	}
+	w.Flush()
+	return reply(buf.String())
+}
+
+func (c *ControlRoomCommands) CmdAdminExport(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	usage := func() error {
+		return reply("usage: !export csv|jsonl [user USERID] [from DATE] [until DATE] [memo PATTERN]")
+	}
+	if len(cmd.Args)%2 != 1 {
+		return usage()
+	}
+	format := cmd.Args[0]
+	if format != CSVFormat && format != JSONLFormat {
+		return usage()
+	}
+
+	filter := sys.LedgerFilter{}
+	var err error
+	for idx := 1; idx+1 < len(cmd.Args); idx += 2 {
+		arg := cmd.Args[idx+1]
+		switch cmd.Args[idx] {
+		case "user":
+			filter.UserID = proto.UserID(arg)
+		case "from":
+			if filter.Since, err = ParseDate(arg, time.UTC, false); err != nil {
+				return reply("invalid start date %s: %s", arg, err)
+			}
+		case "until":
+			if filter.Until, err = ParseDate(arg, time.UTC, true); err != nil {
+				return reply("invalid end date %s: %s", arg, err)
+			}
+		case "memo":
+			if filter.Memo, err = regexp.Compile(arg); err != nil {
+				return reply("invalid memo pattern %s: %s", arg, err)
+			}
+		default:
+			return usage()
+		}
+	}
+
+	if err := os.MkdirAll(c.Bot.Config.ExportDir, 0700); err != nil {
+		return reply("error: %s", err)
+	}
+	name := fmt.Sprintf("ledger-%s.%s", c.Bot.DB.Clock().UTC().Format("20060102-150405"), format)
+	path := filepath.Join(c.Bot.Config.ExportDir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	n, err := ExportLedger(c.Bot.DB, filter, format, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return reply("error: %s", err)
+	}
+	return reply("exported %d ledger entries to %s", n, path)
+}
+
 func (c *ControlRoomCommands) CmdAdminJoin(caller *Caller, cmd *Command, reply ReplyFunc) error {
 	if len(cmd.Args) != 1 {
 		return reply("usage: !join ROOM")
@@ -148,6 +445,33 @@ func (c *ControlRoomCommands) CmdAdminJoin(caller *Caller, cmd *Command, reply R
 	}
 }
 
+func (c *ControlRoomCommands) CmdAdminLimit(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	switch len(cmd.Args) {
+	case 1:
+		userID := proto.UserID(cmd.Args[0])
+		advertiser, err := sys.GetAdvertiser(c.Bot.DB, userID)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if advertiser.Paused {
+			return reply("%s has a credit limit of %s (balance %s, paused at limit)", userID, advertiser.CreditLimit, advertiser.Balance)
+		}
+		return reply("%s has a credit limit of %s (balance %s)", userID, advertiser.CreditLimit, advertiser.Balance)
+	case 2:
+		userID := proto.UserID(cmd.Args[0])
+		limit, err := ParseCents(cmd.Args[1])
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if err := sys.SetCreditLimit(c.Bot.DB, userID, limit); err != nil {
+			return reply("error: %s", err)
+		}
+		return reply("credit limit of %s set to %s", userID, limit)
+	default:
+		return reply("usage: !limit USERID [AMOUNT]")
+	}
+}
+
 func (c *ControlRoomCommands) CmdAdminPart(caller *Caller, cmd *Command, reply ReplyFunc) error {
 	if len(cmd.Args) != 1 {
 		return reply("usage: !part ROOM")
@@ -178,6 +502,23 @@ func (c *ControlRoomCommands) CmdAdminRegister(caller *Caller, cmd *Command, rep
 	return nil
 }
 
+func (c *ControlRoomCommands) CmdAdminRefund(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	if len(cmd.Args) < 1 {
+		return reply("usage: !refund TXID [MEMO]")
+	}
+
+	refund, charge, err := sys.Refund(c.Bot.DB, cmd.Args[0], cmd.Rest(2))
+	if err != nil {
+		return reply("error: %s", err)
+	}
+
+	msg := fmt.Sprintf("refunded %s to %s as %s, balance now %s", refund.Cents, refund.To, refund.TxID, refund.Balance)
+	if charge != nil {
+		msg += fmt.Sprintf(" (rolled back charge for %s in &%s)", charge.Creative, charge.Room)
+	}
+	return reply(msg)
+}
+
 func (c *ControlRoomCommands) CmdAdminReset(caller *Caller, cmd *Command, reply ReplyFunc) error {
 	resetBalances := func() error {
 		if err := sys.ResetBalances(c.Bot.DB); err != nil {
@@ -244,8 +585,48 @@ func (c *ControlRoomCommands) CmdAdminShutdown(caller *Caller, cmd *Command, rep
 }
 
 func (c *ControlRoomCommands) CmdAdminStimulate(caller *Caller, cmd *Command, reply ReplyFunc) error {
-	if len(cmd.Args) != 1 {
-		return reply("usage: !stimulate AMOUNT")
+	usage := "usage: !stimulate AMOUNT [every DAY] [expires DURATION] | list | cancel ID"
+
+	listSchedules := func() error {
+		schedules, err := sys.StimulusSchedules(c.Bot.DB)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if len(schedules) == 0 {
+			return reply("no stimulus scheduled")
+		}
+		buf := &bytes.Buffer{}
+		w := TabWriter(buf)
+		fmt.Fprintln(w, "ID\tAmount\tEvery\tExpires\tNext\t")
+		for _, s := range schedules {
+			expires := "-"
+			if s.Expiry > 0 {
+				expires = s.Expiry.String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", s.ID, s.Amount, s.Every, expires, s.Next.UTC().Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+		return reply(buf.String())
+	}
+
+	if len(cmd.Args) == 0 {
+		return reply(usage)
+	}
+	switch cmd.Args[0] {
+	case "list":
+		return listSchedules()
+	case "cancel":
+		if len(cmd.Args) != 2 {
+			return reply(usage)
+		}
+		cancelled, err := sys.CancelStimulus(c.Bot.DB, cmd.Args[1])
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if !cancelled {
+			return reply("no stimulus scheduled with ID %s", cmd.Args[1])
+		}
+		return reply("cancelled stimulus %s", cmd.Args[1])
 	}
 
 	stimulusStr := cmd.Args[0]
@@ -254,10 +635,43 @@ func (c *ControlRoomCommands) CmdAdminStimulate(caller *Caller, cmd *Command, re
 		return reply("invalid stimulus: %s", stimulusStr)
 	}
 
-	if err := sys.AddStimulus(c.Bot.DB, stimulus); err != nil {
+	var (
+		every  string
+		expiry time.Duration
+	)
+	for i := 1; i < len(cmd.Args); i += 2 {
+		if i+1 >= len(cmd.Args) {
+			return reply(usage)
+		}
+		switch cmd.Args[i] {
+		case "every":
+			if every, err = sys.ParseStimulusEvery(cmd.Args[i+1]); err != nil {
+				return reply("error: %s", err)
+			}
+		case "expires":
+			if expiry, err = ParseDuration(cmd.Args[i+1]); err != nil {
+				return reply("invalid duration: %s", err)
+			}
+		default:
+			return reply(usage)
+		}
+	}
+
+	if every != "" {
+		s, err := sys.ScheduleStimulus(c.Bot.DB, stimulus, every, expiry)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		return reply("scheduled stimulus %s: %s, next on %s", s.ID, s, s.Next.UTC().Format("2006-01-02"))
+	}
+
+	if err := sys.AddStimulus(c.Bot.DB, stimulus, expiry); err != nil {
 		return reply("error: %s", err)
 	}
 
+	if expiry > 0 {
+		return reply("promotional stimulus rolled out, expiring in %s", expiry)
+	}
 	return reply("stimulus package rolled out")
 }
 
@@ -290,7 +704,22 @@ func (c *ControlRoomCommands) CmdGeneralBalance(caller *Caller, cmd *Command, re
 	if err != nil {
 		return reply("error: %s", err)
 	}
-	return reply("%s balance is %s", adj, advertiser.Balance)
+	msg := fmt.Sprintf("%s balance is %s", adj, advertiser.Balance)
+	if advertiser.Promo > 0 {
+		msg += fmt.Sprintf(" (%s paid, %s promotional", advertiser.Balance-advertiser.Promo, advertiser.Promo)
+		if len(advertiser.PromoLots) > 0 {
+			lot := advertiser.PromoLots[0]
+			msg += fmt.Sprintf(", %s expiring %s", lot.Remaining, lot.Expires.UTC().Format("2006-01-02 15:04 MST"))
+		}
+		msg += ")"
+	}
+	if advertiser.CreditLimit > 0 {
+		msg += fmt.Sprintf(", with a credit limit of %s", advertiser.CreditLimit)
+	}
+	if advertiser.Paused {
+		msg += "; spends are paused until funds are added"
+	}
+	return reply(msg)
 }
 
 func (c *ControlRoomCommands) CmdGeneralHelp(caller *Caller, cmd *Command, reply ReplyFunc) error {
@@ -298,32 +727,101 @@ func (c *ControlRoomCommands) CmdGeneralHelp(caller *Caller, cmd *Command, reply
 }
 
 func (c *ControlRoomCommands) CmdGeneralLedger(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	const pageSize = 25
+
+	usage := func() error {
+		return reply("usage: !ledger [USERID] [page N] [before TXID] [from DATE] [until DATE] [with USERID] [memo TEXT]")
+	}
+
+	args := cmd.Args
 	userID := caller.UserID
 	if caller.Host {
-		if len(cmd.Args) > 0 {
-			userID = proto.UserID(cmd.Args[0])
-		} else {
-			userID = sys.House
+		userID = sys.House
+		if len(args) > 0 {
+			switch args[0] {
+			case "page", "before", "from", "until", "with", "memo":
+			default:
+				userID = proto.UserID(args[0])
+				args = args[1:]
+			}
 		}
 	}
-
-	ledger, err := sys.Ledger(c.Bot.DB, userID, 25)
+	loc, err := sys.GetLocation(c.Bot.DB, userID)
 	if err != nil {
 		return reply("error: %s", err)
 	}
 
+	page := 1
+	before := ""
+	filter := sys.LedgerFilter{UserID: userID}
+	offset := len(cmd.Args) - len(args)
+options:
+	for idx := 0; idx < len(args); idx += 2 {
+		if idx+1 == len(args) {
+			return usage()
+		}
+		arg := args[idx+1]
+		switch args[idx] {
+		case "page":
+			if page, err = strconv.Atoi(arg); err != nil || page < 1 {
+				return reply("invalid page: %s", arg)
+			}
+		case "before":
+			before = arg
+		case "from":
+			if filter.Since, err = ParseDate(arg, loc, false); err != nil {
+				return reply("invalid start date %s: %s", arg, err)
+			}
+		case "until":
+			if filter.Until, err = ParseDate(arg, loc, true); err != nil {
+				return reply("invalid end date %s: %s", arg, err)
+			}
+		case "with":
+			filter.Counterparty = proto.UserID(arg)
+		case "memo":
+			filter.Memo = regexp.MustCompile("(?i)" + regexp.QuoteMeta(cmd.Rest(offset+idx+2)))
+			break options
+		default:
+			return usage()
+		}
+	}
+
+	var ledger []sys.LedgerEntry
+	more := false
+	for n := 1; n <= page; n++ {
+		if ledger, more, err = sys.QueryLedger(c.Bot.DB, filter, before, pageSize); err != nil {
+			return reply("error: %s", err)
+		}
+		if n < page {
+			if !more {
+				return reply("no transactions on page %d", page)
+			}
+			before = ledger[0].TxID.String()
+		}
+	}
+
 	if len(ledger) == 0 {
+		if before != "" {
+			return reply("no transactions before %s", before)
+		}
 		return reply("no transactions")
 	}
 
 	buf := &bytes.Buffer{}
-	fmt.Fprintf(buf, "ledger for %s:\n", userID)
+	fmt.Fprintf(buf, "ledger for %s, page %d:\n", userID, page)
 	w := TabWriter(buf)
-	fmt.Fprintln(w, "ID\tFrom\tTo\tMemo\tAmount\tBalance\t")
+	fmt.Fprintln(w, "ID\tTime\tFrom\tTo\tMemo\tAmount\tBalance\t")
 	for _, entry := range ledger {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", entry.TxID, entry.From, entry.To, entry.Memo, entry.Cents, entry.Balance)
+		t := "-"
+		if !entry.Time.IsZero() {
+			t = entry.Time.In(loc).Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", entry.TxID, t, entry.From, entry.To, entry.Memo, entry.Cents, entry.Balance)
 	}
 	w.Flush()
+	if more {
+		fmt.Fprintf(buf, "\nmore transactions on page %d", page+1)
+	}
 	return reply(buf.String())
 }
 
@@ -413,21 +911,214 @@ func (c *ControlRoomCommands) CmdScoreboard(caller *Caller, cmd *Command, reply
 	return reply(buf.String())
 }
 
+func (c *ControlRoomCommands) CmdReport(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	usage := func() error {
+		return reply("usage: !report [by hour|day|advertiser|room|creative|keyword] [last DURATION] [from DATE] [until DATE] [in ROOM] [for CREATIVE] [keyword WORD] [account USERID]")
+	}
+	loc, err := sys.GetLocation(c.Bot.DB, caller.UserID)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	q := sys.ReportQuery{
+		By:     sys.ReportByDay,
+		Since:  c.Bot.DB.Clock().Add(-7 * 24 * time.Hour),
+		UserID: caller.UserID,
+	}
+	if caller.Host {
+		q.UserID = ""
+	}
+	if len(cmd.Args)%2 != 0 {
+		return usage()
+	}
+	for idx := 0; idx+1 < len(cmd.Args); idx += 2 {
+		arg := cmd.Args[idx+1]
+		switch cmd.Args[idx] {
+		case "by":
+			switch arg {
+			case sys.ReportByHour, sys.ReportByDay, sys.ReportByAdvertiser, sys.ReportByRoom, sys.ReportByCreative, sys.ReportByKeyword:
+				q.By = arg
+			default:
+				return reply("invalid grouping: %s", arg)
+			}
+		case "last":
+			d, err := ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return reply("invalid duration: %s", arg)
+			}
+			q.Since = c.Bot.DB.Clock().Add(-d)
+		case "from":
+			if q.Since, err = ParseDate(arg, loc, false); err != nil {
+				return reply("invalid start date %s: %s", arg, err)
+			}
+		case "until":
+			if q.Until, err = ParseDate(arg, loc, true); err != nil {
+				return reply("invalid end date %s: %s", arg, err)
+			}
+		case "in":
+			q.Room = strings.ToLower(strings.TrimPrefix(arg, "&"))
+		case "for":
+			q.Creative = arg
+		case "keyword":
+			words := sys.ParseWordList(arg).Slice()
+			if len(words) != 1 {
+				return reply("invalid keyword: %s", arg)
+			}
+			q.Keyword = words[0]
+		case "account":
+			if !caller.Host {
+				return reply("only hosts may report on other accounts")
+			}
+			q.UserID = proto.UserID(arg)
+		default:
+			return usage()
+		}
+	}
+
+	rows, err := sys.Report(c.Bot.DB, q)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	if len(rows) == 0 {
+		return reply("no activity since %s", q.Since.In(loc).Format("2006-01-02 15:04 MST"))
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "report by %s since %s:\n", q.By, q.Since.In(loc).Format("2006-01-02 15:04 MST"))
+	if q.By == sys.ReportByKeyword || q.Keyword != "" {
+		fmt.Fprintf(buf, "(ads matching several keywords are divided evenly among them)\n")
+	}
+	w := TabWriter(buf)
+	fmt.Fprintf(w, "%s\tAds\tImpressions\tEngagements\tRate\tSpent\tCPI\t\n", strings.Title(q.By))
+	for _, row := range rows {
+		group := row.Group
+		if group == "" {
+			group = "-"
+		}
+		rate, cpi := "-", "-"
+		if row.AdsDisplayed > 0 {
+			rate = fmt.Sprintf("%.1f%%", 100*float64(row.Engagements)/float64(row.AdsDisplayed))
+		}
+		if row.Impressions > 0 {
+			cpi = sys.Cents(row.AmountSpent / row.Impressions).String()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t\n",
+			group, row.AdsDisplayed, row.Impressions, row.Engagements, rate, sys.Cents(row.AmountSpent), cpi)
+	}
+	w.Flush()
+	return reply(buf.String())
+}
+
 func (c *ControlRoomCommands) CmdSpend(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	usage := func() error {
+		return reply("usage: !spend up to MAXBID on CREATIVE[=WEIGHT,...] [rotate weighted|bandit] [daily CAP] [lifetime CAP] [in ROOMS] [except ROOMS] [cap COUNT/WINDOW] [from DATE] [until DATE] [during DAYS:HOURS] [per impression|engagement] [engagements MAX] KEYWORD|\"PHRASE\"|[EXACT PHRASE]|-NEGATIVE...")
+	}
 	if len(cmd.Args) < 6 || cmd.Args[0] != "up" || cmd.Args[1] != "to" || cmd.Args[3] != "on" {
-		return reply("usage: !spend up to MAXBID on CREATIVE KEYWORDS...")
+		return usage()
 	}
 	maxBidStr := cmd.Args[2]
 	maxBid, err := ParseCents(maxBidStr)
 	if err != nil {
 		return reply("invalid max bid: %s", maxBidStr)
 	}
-	creativeName := cmd.Args[4]
+	creatives, err := ParseCreatives(cmd.Args[4])
+	if err != nil {
+		return reply("invalid creatives: %s", err)
+	}
+	creativeName := creatives[0].Name
 	userID := caller.UserID
 	if caller.Host {
 		userID = sys.House
 	}
-	_, replaced, err := sys.NewSpend(c.Bot.DB, userID, creativeName, cmd.Rest(6), maxBid)
+	spend := &sys.Spend{
+		UserID:       userID,
+		CreativeName: creativeName,
+		MaxBid:       maxBid,
+	}
+	if len(creatives) > 1 {
+		spend.Creatives = creatives
+		spend.Rotation = sys.WeightedRotation
+	}
+	loc, err := sys.GetLocation(c.Bot.DB, userID)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+
+	idx := 5
+options:
+	for ; idx+1 < len(cmd.Args); idx += 2 {
+		switch cmd.Args[idx] {
+		case "rotate":
+			switch cmd.Args[idx+1] {
+			case sys.WeightedRotation, sys.BanditRotation:
+				spend.Rotation = cmd.Args[idx+1]
+			default:
+				return reply("invalid rotation: %s", cmd.Args[idx+1])
+			}
+		case "daily":
+			if spend.DailyCap, err = ParseCents(cmd.Args[idx+1]); err != nil {
+				return reply("invalid daily cap: %s", cmd.Args[idx+1])
+			}
+		case "lifetime":
+			if spend.LifetimeCap, err = ParseCents(cmd.Args[idx+1]); err != nil {
+				return reply("invalid lifetime cap: %s", cmd.Args[idx+1])
+			}
+		case "in":
+			spend.Rooms = ParseRooms(cmd.Args[idx+1])
+		case "except":
+			spend.ExcludeRooms = ParseRooms(cmd.Args[idx+1])
+		case "cap":
+			fc, err := ParseFrequencyCap(cmd.Args[idx+1])
+			if err != nil {
+				return reply("invalid frequency cap %s: %s", cmd.Args[idx+1], err)
+			}
+			spend.FrequencyCap = &fc
+		case "from":
+			start, err := ParseDate(cmd.Args[idx+1], loc, false)
+			if err != nil {
+				return reply("invalid start date %s: %s", cmd.Args[idx+1], err)
+			}
+			spend.Start = &start
+		case "until":
+			end, err := ParseDate(cmd.Args[idx+1], loc, true)
+			if err != nil {
+				return reply("invalid end date %s: %s", cmd.Args[idx+1], err)
+			}
+			spend.End = &end
+		case "during":
+			if spend.Schedule, err = sys.ParseSchedule(cmd.Args[idx+1]); err != nil {
+				return reply("invalid schedule %s: %s", cmd.Args[idx+1], err)
+			}
+		case "per":
+			switch cmd.Args[idx+1] {
+			case sys.ImpressionBilling:
+				spend.Billing = ""
+			case sys.EngagementBilling:
+				spend.Billing = sys.EngagementBilling
+			default:
+				return reply("invalid billing: %s", cmd.Args[idx+1])
+			}
+		case "engagements":
+			n, err := strconv.Atoi(cmd.Args[idx+1])
+			if err != nil || n < 1 {
+				return reply("invalid engagement cap: %s", cmd.Args[idx+1])
+			}
+			spend.EngagementCap = n
+		default:
+			break options
+		}
+	}
+	if idx >= len(cmd.Args) {
+		return usage()
+	}
+	spend.Keywords, spend.Phrases, spend.Negative = sys.ParseKeywords(cmd.Rest(idx + 1))
+	if len(spend.Keywords) == 0 && len(spend.Phrases) == 0 {
+		return usage()
+	}
+	if err := spend.Validate(); err != nil {
+		return reply("invalid spend: %s", err)
+	}
+
+	replaced, err := sys.NewSpend(c.Bot.DB, spend)
 	if err != nil {
 		return reply("error: %s", err)
 	}
@@ -456,6 +1147,10 @@ func (c *ControlRoomCommands) CmdStats(caller *Caller, cmd *Command, reply Reply
 	w := TabWriter(buf)
 	fmt.Fprintf(w, "Ads displayed:\t%d\t\n", m.AdsDisplayed)
 	fmt.Fprintf(w, "Impressions:\t%d\t\n", m.Impressions)
+	fmt.Fprintf(w, "Engagements:\t%d\t\n", m.Engagements)
+	if m.AdsDisplayed > 0 {
+		fmt.Fprintf(w, "Engagement rate:\t%.1f%%\t\n", 100*float64(m.Engagements)/float64(m.AdsDisplayed))
+	}
 	if userID == sys.System {
 		fmt.Fprintf(w, "Total revenue:\t%s\t\n", sys.Cents(m.AmountSpent-m.AmountSpentByHouse))
 	} else {
@@ -465,5 +1160,167 @@ func (c *ControlRoomCommands) CmdStats(caller *Caller, cmd *Command, reply Reply
 		fmt.Fprintf(w, "CPI:\t%s\t\n", sys.Cents(m.AmountSpent/m.Impressions))
 	}
 	w.Flush()
+
+	creatives, err := sys.LoadCreativeMetrics(c.Bot.DB, userID)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	if len(creatives) > 0 {
+		fmt.Fprintln(buf)
+		w = TabWriter(buf)
+		fmt.Fprintln(w, "Creative\tDelivered\tEngagements\tRate\t")
+		for _, cm := range creatives {
+			rate := float64(0)
+			if cm.AdsDisplayed > 0 {
+				rate = 100 * float64(cm.Engagements) / float64(cm.AdsDisplayed)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t\n", cm.Name, cm.AdsDisplayed, cm.Engagements, rate)
+		}
+		w.Flush()
+	}
 	return reply(buf.String())
 }
+
+func (c *ControlRoomCommands) CmdToken(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	usage := func() error {
+		return reply("usage: !token create [NAME]|list|revoke ID")
+	}
+	if len(cmd.Args) == 0 {
+		return usage()
+	}
+	userID := caller.UserID
+	if caller.Host {
+		userID = sys.House
+	}
+
+	switch cmd.Args[0] {
+	case "create":
+		token, t, err := sys.CreateToken(c.Bot.DB, userID, cmd.Rest(2))
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		return reply("created token %s for %s: %s (it won't be shown again, revoke with !token revoke %s)", t.ID, userID, token, t.ID)
+	case "list":
+		tokens, err := sys.Tokens(c.Bot.DB, userID)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if len(tokens) == 0 {
+			return reply("no tokens, create one with !token create")
+		}
+		buf := &bytes.Buffer{}
+		fmt.Fprintf(buf, "tokens for %s:\n", userID)
+		w := TabWriter(buf)
+		fmt.Fprintln(w, "ID\tName\tCreated\t")
+		for _, t := range tokens {
+			name := t.Name
+			if name == "" {
+				name = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", t.ID, name, t.Created.UTC().Format("2006-01-02 15:04 MST"))
+		}
+		w.Flush()
+		return reply(buf.String())
+	case "revoke":
+		if len(cmd.Args) != 2 {
+			return usage()
+		}
+		revoked, err := sys.RevokeToken(c.Bot.DB, userID, cmd.Args[1])
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		if !revoked {
+			return reply("no token %s", cmd.Args[1])
+		}
+		return reply("revoked token %s", cmd.Args[1])
+	default:
+		return usage()
+	}
+}
+
+func (c *ControlRoomCommands) CmdTimezone(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	userID := caller.UserID
+	if caller.Host {
+		userID = sys.House
+	}
+	if len(cmd.Args) == 0 {
+		loc, err := sys.GetLocation(c.Bot.DB, userID)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		return reply("your time zone is %s", loc)
+	}
+	if len(cmd.Args) != 1 {
+		return reply("usage: !timezone [ZONE]")
+	}
+	loc, err := sys.SetTimeZone(c.Bot.DB, userID, cmd.Args[0])
+	if err != nil {
+		return reply("invalid time zone: %s", err)
+	}
+	return reply("time zone set to %s, now %s there", loc, time.Now().In(loc).Format("Mon 15:04"))
+}
+
+func (c *ControlRoomCommands) CmdTransfer(caller *Caller, cmd *Command, reply ReplyFunc) error {
+	from := caller.UserID
+	if caller.Host {
+		from = sys.House
+	}
+
+	transfer := func(t pendingTransfer) error {
+		fromBalance, _, err := sys.Transfer(c.Bot.DB, t.Cents, from, t.To, t.Memo)
+		if err != nil {
+			return reply("error: %s", err)
+		}
+		return reply("transferred %s to %s, your balance is now %s", t.Cents, t.To, fromBalance)
+	}
+
+	if len(cmd.Args) == 1 && cmd.Args[0] == "confirm" {
+		t, ok := c.Bot.transfers.take(from, time.Now())
+		if !ok {
+			return reply("no transfer is awaiting confirmation")
+		}
+		return transfer(t)
+	}
+	if len(cmd.Args) == 1 && cmd.Args[0] == "cancel" {
+		t, ok := c.Bot.transfers.cancel(from)
+		if !ok {
+			return reply("no transfer is awaiting confirmation")
+		}
+		return reply("cancelled transfer of %s to %s", t.Cents, t.To)
+	}
+
+	if len(cmd.Args) < 2 {
+		return reply("usage: !transfer USERID AMOUNT [MEMO] | !transfer confirm | !transfer cancel")
+	}
+
+	to := proto.UserID(cmd.Args[0])
+	if kind, _ := to.Parse(); kind != "account" {
+		return reply("error: %s is not an account", to)
+	}
+	if to == from {
+		return reply("error: can't transfer to yourself")
+	}
+	cents, err := ParseCents(cmd.Args[1])
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	if cents <= 0 {
+		return reply("error: amount must be positive")
+	}
+
+	advertiser, err := sys.GetAdvertiser(c.Bot.DB, from)
+	if err != nil {
+		return reply("error: %s", err)
+	}
+	if paid := advertiser.Balance - advertiser.Promo; from != sys.House && paid < cents {
+		return reply("error: %s (paid balance is %s)", sys.ErrInsufficientFunds, paid)
+	}
+
+	t := pendingTransfer{To: to, Cents: cents, Memo: cmd.Rest(3)}
+	if c.Bot.confirmAbove > 0 && cents > c.Bot.confirmAbove {
+		t.Expires = time.Now().Add(TransferConfirmWindow)
+		c.Bot.transfers.hold(from, t)
+		return reply("send !transfer confirm within %s to transfer %s to %s, or !transfer cancel", TransferConfirmWindow, cents, to)
+	}
+	return transfer(t)
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"euphoria.io/adbot/sys"
+	"euphoria.io/heim/proto"
+)
+
+const (
+	CSVFormat   = "csv"
+	JSONLFormat = "jsonl"
+)
+
+type LedgerWriter interface {
+	Write(userID proto.UserID, entry *sys.LedgerEntry) error
+	Flush() error
+}
+
+func NewLedgerWriter(format string, w io.Writer) (LedgerWriter, error) {
+	switch format {
+	case CSVFormat:
+		lw := &csvLedgerWriter{w: csv.NewWriter(w)}
+		return lw, lw.w.Write([]string{"account", "txid", "time", "from", "to", "cents", "balance", "memo"})
+	case JSONLFormat:
+		return &jsonlLedgerWriter{json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s, expected csv or jsonl", format)
+	}
+}
+
+type csvLedgerWriter struct {
+	w *csv.Writer
+}
+
+func (lw *csvLedgerWriter) Write(userID proto.UserID, entry *sys.LedgerEntry) error {
+	t := ""
+	if !entry.Time.IsZero() {
+		t = entry.Time.UTC().Format(time.RFC3339)
+	}
+	return lw.w.Write([]string{
+		string(userID),
+		entry.TxID.String(),
+		t,
+		string(entry.From),
+		string(entry.To),
+		strconv.FormatInt(int64(entry.Cents), 10),
+		strconv.FormatInt(int64(entry.Balance), 10),
+		entry.Memo,
+	})
+}
+
+func (lw *csvLedgerWriter) Flush() error {
+	lw.w.Flush()
+	return lw.w.Error()
+}
+
+type jsonlLedgerWriter struct {
+	enc *json.Encoder
+}
+
+func (lw *jsonlLedgerWriter) Write(userID proto.UserID, entry *sys.LedgerEntry) error {
+	return lw.enc.Encode(struct {
+		Account proto.UserID
+		*sys.LedgerEntry
+	}{userID, entry})
+}
+
+func (lw *jsonlLedgerWriter) Flush() error { return nil }
+
+func ExportLedger(db *sys.DB, filter sys.LedgerFilter, format string, w io.Writer) (int, error) {
+	lw, err := NewLedgerWriter(format, w)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = sys.MapLedger(db, filter, func(userID proto.UserID, entry *sys.LedgerEntry) error {
+		n++
+		return lw.Write(userID, entry)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, lw.Flush()
+}
+
+func RunExportLedger(args []string) int {
+	flags := flag.NewFlagSet("export-ledger", flag.ContinueOnError)
+	dbPath := flags.String("db", "adbot.db", "path to database file (opened read-only)")
+	format := flags.String("format", CSVFormat, "output format: csv or jsonl")
+	output := flags.String("o", "", "path to write the export to (default stdout)")
+	userID := flags.String("user", "", "only export the ledger of this account")
+	since := flags.String("from", "", "only export entries on or after this date (YYYY-MM-DD, UTC)")
+	until := flags.String("until", "", "only export entries up to and including this date (YYYY-MM-DD, UTC)")
+	memo := flags.String("memo", "", "only export entries whose memo matches this regular expression")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s export-ledger OPTIONS\n\n", os.Args[0])
+		flags.PrintDefaults()
+		fmt.Println()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	filter := sys.LedgerFilter{UserID: proto.UserID(*userID)}
+	var err error
+	if *since != "" {
+		if filter.Since, err = ParseDate(*since, time.UTC, false); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -from date: %s\n", err)
+			return 1
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = ParseDate(*until, time.UTC, true); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -until date: %s\n", err)
+			return 1
+		}
+	}
+	if *memo != "" {
+		if filter.Memo, err = regexp.Compile(*memo); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -memo pattern: %s\n", err)
+			return 1
+		}
+	}
+
+	db, err := sys.OpenReadOnly(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening %s: %s\n", *dbPath, err)
+		return 2
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return 2
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := ExportLedger(db, filter, *format, w)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "exported %d ledger entries\n", n)
+	return 0
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"euphoria.io/adbot/sys"
+)
+
+func WriteAuditReport(w io.Writer, report *sys.AuditReport, maxProblems int) {
+	fmt.Fprintf(w, "checked %d accounts, %d transactions and %d spends\n",
+		report.Accounts, report.Transactions, report.Spends)
+	if len(report.Problems) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return
+	}
+	fmt.Fprintf(w, "%d problems found:\n", len(report.Problems))
+	for i, problem := range report.Problems {
+		if maxProblems > 0 && i == maxProblems {
+			fmt.Fprintf(w, "... and %d more\n", len(report.Problems)-maxProblems)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+}
+
+func RunFsck(args []string) int {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	dbPath := flags.String("db", "adbot.db", "path to database file (opened read-only)")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s fsck OPTIONS\n\n", os.Args[0])
+		flags.PrintDefaults()
+		fmt.Println()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	db, err := sys.OpenReadOnly(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening %s: %s\n", *dbPath, err)
+		return 2
+	}
+	defer db.Close()
+
+	report, err := sys.Audit(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 2
+	}
+	WriteAuditReport(os.Stdout, report, 0)
+	if len(report.Problems) > 0 {
+		return 1
+	}
+	return 0
+}
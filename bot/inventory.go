@@ -6,6 +6,7 @@ import (
 
 	"euphoria.io/adbot/sys"
 	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
 )
 
 func MinBid(userCount, msgsSinceLastAd int) sys.Cents {
@@ -19,23 +20,57 @@ func MinBid(userCount, msgsSinceLastAd int) sys.Cents {
 type InventorySpeechHandler struct {
 	Bot             *Bot
 	Room            *Room
+	OnDeliver       func(sys.Selection, int)
 	msgsSinceLastAd uint64
 }
 
+func (ish *InventorySpeechHandler) MinBid() sys.Cents {
+	return MinBid(ish.Room.UserCount(), int(atomic.LoadUint64(&ish.msgsSinceLastAd)))
+}
+
 func (ish *InventorySpeechHandler) HandleSpeech(msg *proto.Message, reply ReplyFunc) error {
+	var none snowflake.Snowflake
+	if msg.Parent != none {
+		sponsored, err := sys.RecordEngagement(ish.Bot.DB, msg.Parent, msg.ID, msg.Sender.ID, msg.Content)
+		if err != nil {
+			return err
+		}
+		if sponsored != nil {
+			return nil
+		}
+	}
+
 	impressions := ish.Room.UserCount()
 
-	creative, cost, err := sys.Select(ish.Bot.DB, msg.Content, MinBid(impressions, int(ish.msgsSinceLastAd)))
+	selections, err := sys.Select(ish.Bot.DB, ish.Room.Name, msg.Content, MinBid(impressions, int(atomic.LoadUint64(&ish.msgsSinceLastAd))), impressions)
 	if err != nil {
 		return err
 	}
-	if creative == nil {
+	ish.Bot.Monitor.AuctionRun()
+	if len(selections) == 0 {
 		atomic.AddUint64(&ish.msgsSinceLastAd, 1)
 		return nil
 	}
 
-	if err := sys.Bill(ish.Bot.DB, ish.Room.Name, creative.UserID, cost, creative.Name, impressions); err != nil {
-		return err
+	for _, selection := range selections {
+		if err := ish.deliver(msg, selection, impressions); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreUint64(&ish.msgsSinceLastAd, 0)
+	return nil
+}
+
+func (ish *InventorySpeechHandler) deliver(msg *proto.Message, selection sys.Selection, impressions int) error {
+	if ish.OnDeliver != nil {
+		ish.OnDeliver(selection, impressions)
+	}
+
+	creative := selection.Creative
+	price := fmt.Sprintf("a price of %s", selection.Cost)
+	if selection.EngagementPrice > 0 {
+		price = fmt.Sprintf("%s per engagement", selection.EngagementPrice)
 	}
 
 	adv, err := sys.GetAdvertiser(ish.Bot.DB, creative.UserID)
@@ -43,9 +78,9 @@ func (ish *InventorySpeechHandler) HandleSpeech(msg *proto.Message, reply ReplyF
 		return err
 	}
 
-	content := fmt.Sprintf("/me delivered creative %s by %s to &%s at a price of %s", creative.Name, adv.Nick, ish.Room.Name, cost)
+	content := fmt.Sprintf("/me delivered creative %s by %s to &%s at %s", creative.Name, adv.Nick, ish.Room.Name, price)
 	if creative.UserID == sys.House {
-		content = fmt.Sprintf("/me delivered house creative %s to &%s at a price of %s", creative.Name, ish.Room.Name, cost)
+		content = fmt.Sprintf("/me delivered house creative %s to &%s at %s", creative.Name, ish.Room.Name, price)
 	}
 	if ish.Bot.Config.Ghost {
 		content += " (simulated)"
@@ -56,10 +91,12 @@ func (ish *InventorySpeechHandler) HandleSpeech(msg *proto.Message, reply ReplyF
 		})
 	}
 
-	atomic.StoreUint64(&ish.msgsSinceLastAd, 0)
-
 	if ish.Bot.Config.Ghost {
 		return nil
 	}
-	return reply("sponsored message: %s", creative.Content)
+	id, err := ish.Room.Send(msg.ID, fmt.Sprintf("sponsored message: %s", creative.Content))
+	if err != nil {
+		return err
+	}
+	return sys.RecordSponsored(ish.Bot.DB, id, ish.Room.Name, selection)
 }
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"euphoria.io/adbot/sys"
+)
+
+var txLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type latencyHistogram struct {
+	sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *latencyHistogram) Observe(d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(txLatencyBuckets))
+	}
+	seconds := d.Seconds()
+	for i, le := range txLatencyBuckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (h *latencyHistogram) write(buf *bytes.Buffer, name, labels string) {
+	h.Lock()
+	defer h.Unlock()
+	for i, le := range txLatencyBuckets {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"%g\"} %d\n", name, labels, le, n)
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(buf, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+type Monitor struct {
+	Bot *Bot
+
+	auctions      uint64
+	updateLatency latencyHistogram
+	viewLatency   latencyHistogram
+}
+
+func NewMonitor(b *Bot) *Monitor {
+	m := &Monitor{Bot: b}
+	b.DB.OnTx = m.observeTx
+	return m
+}
+
+func (m *Monitor) observeTx(writable bool, elapsed time.Duration) {
+	if writable {
+		m.updateLatency.Observe(elapsed)
+	} else {
+		m.viewLatency.Observe(elapsed)
+	}
+}
+
+func (m *Monitor) AuctionRun() { atomic.AddUint64(&m.auctions, 1) }
+
+func (m *Monitor) Handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serveMetrics)
+	mux.HandleFunc("/healthz", m.serveHealth)
+	return mux
+}
+
+type roomState struct {
+	name      string
+	control   bool
+	connected bool
+	users     int
+	redials   uint64
+}
+
+func (m *Monitor) rooms() []roomState {
+	b := m.Bot
+	b.Lock()
+	rooms := make([]*Room, 0, len(b.ctrlRooms)+len(b.rooms))
+	for _, room := range b.ctrlRooms {
+		rooms = append(rooms, room)
+	}
+	for _, room := range b.rooms {
+		rooms = append(rooms, room)
+	}
+	b.Unlock()
+
+	states := make([]roomState, len(rooms))
+	for i, room := range rooms {
+		states[i] = roomState{
+			name:      room.Name,
+			control:   room.IsControlRoom(),
+			connected: room.Connected(),
+			redials:   atomic.LoadUint64(&room.redials),
+		}
+		room.Lock()
+		states[i].users = room.UserCount()
+		room.Unlock()
+	}
+	sort.Sort(roomStates(states))
+	return states
+}
+
+type roomStates []roomState
+
+func (rs roomStates) Len() int           { return len(rs) }
+func (rs roomStates) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+func (rs roomStates) Less(i, j int) bool { return rs[i].name < rs[j].name }
+
+func (m *Monitor) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	system, err := sys.LoadMetrics(m.Bot.DB, sys.System)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "# HELP adbot_auctions_total Auctions run since the bot started.")
+	fmt.Fprintln(buf, "# TYPE adbot_auctions_total counter")
+	fmt.Fprintf(buf, "adbot_auctions_total %d\n", atomic.LoadUint64(&m.auctions))
+	fmt.Fprintln(buf, "# HELP adbot_ads_delivered_total Sponsored messages delivered.")
+	fmt.Fprintln(buf, "# TYPE adbot_ads_delivered_total counter")
+	fmt.Fprintf(buf, "adbot_ads_delivered_total %d\n", system.AdsDisplayed)
+	fmt.Fprintln(buf, "# HELP adbot_impressions_total Impressions of sponsored messages.")
+	fmt.Fprintln(buf, "# TYPE adbot_impressions_total counter")
+	fmt.Fprintf(buf, "adbot_impressions_total %d\n", system.Impressions)
+	fmt.Fprintln(buf, "# HELP adbot_engagements_total Replies and reactions to sponsored messages.")
+	fmt.Fprintln(buf, "# TYPE adbot_engagements_total counter")
+	fmt.Fprintf(buf, "adbot_engagements_total %d\n", system.Engagements)
+	fmt.Fprintln(buf, "# HELP adbot_revenue_cents_total Amount charged to advertisers, excluding house ads.")
+	fmt.Fprintln(buf, "# TYPE adbot_revenue_cents_total counter")
+	fmt.Fprintf(buf, "adbot_revenue_cents_total %d\n", system.AmountSpent-system.AmountSpentByHouse)
+
+	rooms := m.rooms()
+	fmt.Fprintln(buf, "# HELP adbot_room_connected Whether the bot is connected and joined to the room.")
+	fmt.Fprintln(buf, "# TYPE adbot_room_connected gauge")
+	for _, room := range rooms {
+		connected := 0
+		if room.connected {
+			connected = 1
+		}
+		fmt.Fprintf(buf, "adbot_room_connected{room=%q,control=\"%t\"} %d\n", room.name, room.control, connected)
+	}
+	fmt.Fprintln(buf, "# HELP adbot_room_users Number of sessions present in the room.")
+	fmt.Fprintln(buf, "# TYPE adbot_room_users gauge")
+	for _, room := range rooms {
+		fmt.Fprintf(buf, "adbot_room_users{room=%q} %d\n", room.name, room.users)
+	}
+	fmt.Fprintln(buf, "# HELP adbot_room_redials_total Connection attempts made to the room.")
+	fmt.Fprintln(buf, "# TYPE adbot_room_redials_total counter")
+	for _, room := range rooms {
+		fmt.Fprintf(buf, "adbot_room_redials_total{room=%q} %d\n", room.name, room.redials)
+	}
+
+	fmt.Fprintln(buf, "# HELP adbot_db_tx_seconds Latency of bolt transactions.")
+	fmt.Fprintln(buf, "# TYPE adbot_db_tx_seconds histogram")
+	m.updateLatency.write(buf, "adbot_db_tx_seconds", `type="update"`)
+	m.viewLatency.write(buf, "adbot_db_tx_seconds", `type="view"`)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	buf.WriteTo(w)
+}
+
+func (m *Monitor) serveHealth(w http.ResponseWriter, r *http.Request) {
+	down := []string{}
+	for _, room := range m.rooms() {
+		if room.control && !room.connected {
+			down = append(down, "&"+room.name)
+		}
+	}
+	if len(down) > 0 {
+		http.Error(w, fmt.Sprintf("control rooms disconnected: %v", down), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
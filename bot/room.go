@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"euphoria.io/adbot/sys"
 	"euphoria.io/heim-client/client"
 	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
 	"euphoria.io/scope"
 )
 
@@ -46,6 +48,7 @@ type Room struct {
 	ctx             scope.Context
 	backoff         time.Duration
 	joined          bool
+	redials         uint64
 	hosts           SessionSet
 	sessionsByIdEra map[string]SessionSet
 }
@@ -75,6 +78,7 @@ func (r *Room) Redial() {
 		r.c.Close()
 		r.c = nil
 	}
+	r.joined = false
 	r.hosts = SessionSet{}
 	r.sessionsByIdEra = map[string]SessionSet{}
 	r.Unlock()
@@ -94,19 +98,28 @@ func (r *Room) Redial() {
 			return
 		}
 
+		atomic.AddUint64(&r.redials, 1)
 		conn, err := client.DialRoom(r.ctx, r.Config.BaseURL, r.Name, r.CookieJar)
 		if err != nil {
 			fmt.Printf("error dialing %s: %s", r.Name, err)
 			continue
 		}
 
+		r.Lock()
 		r.c = conn
+		r.Unlock()
 		break
 	}
 
 	r.c.Add(r)
 }
 
+func (r *Room) Connected() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.c != nil && r.joined
+}
+
 func (r *Room) UserCount() int {
 	n := 0
 	for _, ss := range r.sessionsByIdEra {
@@ -220,29 +233,47 @@ func (r *Room) SendEvent(event *proto.SendEvent) error {
 	}
 
 	reply := func(format string, args ...interface{}) error {
-		msg := proto.Message{
-			Parent: event.ID,
+		content := format
+		if len(args) > 0 {
+			content = fmt.Sprintf(format, args...)
 		}
-		if len(args) == 0 {
-			msg.Content = format
-		} else {
-			msg.Content = fmt.Sprintf(format, args...)
-		}
-		buf := &bytes.Buffer{}
-		for _, part := range strings.Split(msg.Content, "\t") {
-			tab := 8 - buf.Len()%8
-			if buf.Len() == 0 {
-				tab = 0
-			}
-			for i := 0; i < tab; i++ {
-				buf.WriteRune(' ')
-			}
-			buf.WriteString(part)
-		}
-		msg.Content = buf.String()
-		_, err := r.c.AsyncSend(proto.SendType, msg)
+		_, err := r.c.AsyncSend(proto.SendType, proto.Message{
+			Parent:  event.ID,
+			Content: expandTabs(content),
+		})
 		return err
 	}
 
 	return r.SpeechHandler.HandleSpeech((*proto.Message)(event), reply)
 }
+
+func (r *Room) Send(parent snowflake.Snowflake, content string) (snowflake.Snowflake, error) {
+	var none snowflake.Snowflake
+	resp, err := r.c.Send(proto.SendType, proto.Message{
+		Parent:  parent,
+		Content: expandTabs(content),
+	})
+	if err != nil {
+		return none, err
+	}
+	reply, ok := resp.(*proto.SendReply)
+	if !ok {
+		return none, fmt.Errorf("unexpected reply to send: %T", resp)
+	}
+	return reply.ID, nil
+}
+
+func expandTabs(content string) string {
+	buf := &bytes.Buffer{}
+	for _, part := range strings.Split(content, "\t") {
+		tab := 8 - buf.Len()%8
+		if buf.Len() == 0 {
+			tab = 0
+		}
+		for i := 0; i < tab; i++ {
+			buf.WriteRune(' ')
+		}
+		buf.WriteString(part)
+	}
+	return buf.String()
+}
@@ -3,6 +3,7 @@ package bot
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 
@@ -10,6 +11,17 @@ import (
 )
 
 func Run() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			os.Exit(RunSimulate(os.Args[2:]))
+		case "export-ledger":
+			os.Exit(RunExportLedger(os.Args[2:]))
+		case "fsck":
+			os.Exit(RunFsck(os.Args[2:]))
+		}
+	}
+
 	cfg := &Config{}
 	flags := cfg.FlagSet()
 	if err := flags.Parse(os.Args[1:]); err != nil {
@@ -31,6 +43,16 @@ func Run() {
 
 	bot.Serve(ctx)
 
+	if cfg.HTTPAddr != "" {
+		mux := bot.Monitor.Handler()
+		mux.Handle("/api/", &API{Bot: bot})
+		go func() {
+			if err := http.ListenAndServe(cfg.HTTPAddr, mux); err != nil {
+				ctx.Terminate(fmt.Errorf("http: %s", err))
+			}
+		}()
+	}
+
 	exitCode := 0
 loop:
 	for {
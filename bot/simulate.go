@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"euphoria.io/adbot/sys"
+	"euphoria.io/heim/proto"
+)
+
+type LogEntry struct {
+	Room    string
+	Sender  string
+	Content string
+	Time    time.Time
+}
+
+type SimulationResult struct {
+	Messages  int
+	Filled    int
+	Delivered int
+	Revenue   sys.Cents
+	Expected  sys.Cents
+	Spent     map[proto.UserID]sys.Cents
+}
+
+func (sr *SimulationResult) Report(db *sys.DB, w io.Writer) error {
+	fmt.Fprintf(w, "messages:          %d\n", sr.Messages)
+	fmt.Fprintf(w, "ads delivered:     %d\n", sr.Delivered)
+	if sr.Messages > 0 {
+		fmt.Fprintf(w, "fill rate:         %.2f%%\n", 100*float64(sr.Filled)/float64(sr.Messages))
+	}
+	fmt.Fprintf(w, "projected revenue: %s\n", sr.Revenue)
+	fmt.Fprintf(w, "  from engagements: %s (expected)\n", sr.Expected)
+	fmt.Fprintln(w)
+
+	userIDs := make([]string, 0, len(sr.Spent))
+	for userID, _ := range sr.Spent {
+		userIDs = append(userIDs, string(userID))
+	}
+	sort.Strings(userIDs)
+
+	tw := TabWriter(w)
+	fmt.Fprintln(tw, "Account\tNick\tSpent\t")
+	for _, userID := range userIDs {
+		adv, err := sys.GetAdvertiser(db, proto.UserID(userID))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", userID, adv.Nick, sr.Spent[proto.UserID(userID)])
+	}
+	return tw.Flush()
+}
+
+func Simulate(cfg *Config, log io.Reader, presence time.Duration) (*sys.DB, *SimulationResult, error) {
+	snapshot, err := ioutil.TempFile("", "adbot-simulate-")
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot.Close()
+	if err := sys.Snapshot(cfg.DBPath, snapshot.Name()); err != nil {
+		os.Remove(snapshot.Name())
+		return nil, nil, fmt.Errorf("copying %s: %s", cfg.DBPath, err)
+	}
+
+	simCfg := *cfg
+	simCfg.DBPath = snapshot.Name()
+	simCfg.Ghost = true
+	bot, err := New(&simCfg)
+	if err != nil {
+		os.Remove(snapshot.Name())
+		return nil, nil, err
+	}
+
+	bot.DB.OnSelect = nil
+
+	var now time.Time
+	bot.DB.Clock = func() time.Time { return now }
+
+	result := &SimulationResult{Spent: map[proto.UserID]sys.Cents{}}
+	handlers := map[string]*InventorySpeechHandler{}
+	lastSeen := map[string]map[string]time.Time{}
+	delivered := false
+
+	onDeliver := func(selection sys.Selection, impressions int) {
+		delivered = true
+		result.Delivered++
+		cost := selection.ExpectedCost()
+		result.Spent[selection.Creative.UserID] += cost
+		if selection.Creative.UserID != sys.House {
+			result.Revenue += cost
+			if selection.EngagementPrice > 0 {
+				result.Expected += cost
+			}
+		}
+	}
+	reply := func(string, ...interface{}) error { return nil }
+
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entry := LogEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return bot.DB, nil, err
+		}
+		roomName := strings.ToLower(strings.TrimPrefix(entry.Room, "&"))
+		now = entry.Time
+
+		ish, ok := handlers[roomName]
+		if !ok {
+			room := bot.NewRoom(roomName)
+			ish = &InventorySpeechHandler{
+				Bot:       bot,
+				Room:      room,
+				OnDeliver: onDeliver,
+			}
+			room.SpeechHandler = ish
+			handlers[roomName] = ish
+			lastSeen[roomName] = map[string]time.Time{}
+		}
+
+		seen := lastSeen[roomName]
+		seen[entry.Sender] = entry.Time
+		sessions := SessionSet{}
+		for sender, t := range seen {
+			if entry.Time.Sub(t) > presence {
+				delete(seen, sender)
+				continue
+			}
+			sessions.Add(sender)
+		}
+		ish.Room.sessionsByIdEra = map[string]SessionSet{"simulated": sessions}
+
+		delivered = false
+		if err := ish.HandleSpeech(&proto.Message{Content: entry.Content}, reply); err != nil {
+			return bot.DB, nil, err
+		}
+		result.Messages++
+		if delivered {
+			result.Filled++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return bot.DB, nil, err
+	}
+	return bot.DB, result, nil
+}
+
+func RunSimulate(args []string) int {
+	cfg := &Config{}
+	flags := cfg.FlagSet()
+	logPath := flags.String("log", "", "path to JSONL chat log with room, sender, content and time fields")
+	presence := flags.Duration("presence", 30*time.Minute, "how long a sender counts toward a room's audience after speaking")
+	flags.Usage = func() {
+		fmt.Printf("usage: %s simulate -log FILE OPTIONS\n\n", flags.Name())
+		flags.PrintDefaults()
+		fmt.Println()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if *logPath == "" {
+		flags.Usage()
+		return 1
+	}
+
+	log, err := os.Open(*logPath)
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return 2
+	}
+	defer log.Close()
+
+	db, result, err := Simulate(cfg, log, *presence)
+	if db != nil {
+		defer func() {
+			db.Close()
+			os.Remove(db.Path())
+		}()
+	}
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		return 2
+	}
+
+	if err := result.Report(db, os.Stdout); err != nil {
+		fmt.Printf("error: %s\n", err)
+		return 2
+	}
+	return 0
+}
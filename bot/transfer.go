@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"euphoria.io/adbot/sys"
+	"euphoria.io/heim/proto"
+)
+
+const TransferConfirmWindow = 5 * time.Minute
+
+type pendingTransfer struct {
+	To      proto.UserID
+	Cents   sys.Cents
+	Memo    string
+	Expires time.Time
+}
+
+type pendingTransfers struct {
+	sync.Mutex
+	m map[proto.UserID]pendingTransfer
+}
+
+func (p *pendingTransfers) hold(from proto.UserID, t pendingTransfer) {
+	p.Lock()
+	defer p.Unlock()
+	if p.m == nil {
+		p.m = map[proto.UserID]pendingTransfer{}
+	}
+	p.m[from] = t
+}
+
+func (p *pendingTransfers) take(from proto.UserID, now time.Time) (pendingTransfer, bool) {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.m[from]
+	if !ok {
+		return t, false
+	}
+	delete(p.m, from)
+	return t, now.Before(t.Expires)
+}
+
+func (p *pendingTransfers) cancel(from proto.UserID) (pendingTransfer, bool) {
+	p.Lock()
+	defer p.Unlock()
+	t, ok := p.m[from]
+	delete(p.m, from)
+	return t, ok
+}
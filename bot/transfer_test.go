@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"euphoria.io/adbot/sys"
+)
+
+func TestPendingTransfers(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := &pendingTransfers{}
+
+	cases := []struct {
+		name  string
+		op    string
+		after time.Duration
+		cents sys.Cents
+		ok    bool
+	}{
+		{"nothing held", "take", 0, 0, false},
+		{"hold", "hold", 0, 100, false},
+		{"confirm", "take", time.Minute, 100, true},
+		{"confirm twice", "take", time.Minute, 0, false},
+		{"hold again", "hold", 0, 200, false},
+		{"replace", "hold", 0, 300, false},
+		{"expired", "take", TransferConfirmWindow, 300, false},
+		{"expired is dropped", "take", 0, 0, false},
+		{"hold to cancel", "hold", 0, 400, false},
+		{"cancel", "cancel", 0, 400, true},
+		{"confirm after cancel", "take", 0, 0, false},
+		{"cancel nothing", "cancel", 0, 0, false},
+	}
+	for _, tc := range cases {
+		now := start.Add(tc.after)
+		var held pendingTransfer
+		ok := false
+		switch tc.op {
+		case "hold":
+			p.hold("account:a", pendingTransfer{To: "account:b", Cents: tc.cents, Expires: start.Add(TransferConfirmWindow)})
+			continue
+		case "take":
+			held, ok = p.take("account:a", now)
+		case "cancel":
+			held, ok = p.cancel("account:a")
+		}
+		if ok != tc.ok || held.Cents != tc.cents {
+			t.Errorf("%s: got %s (ok=%v), expected %s (ok=%v)", tc.name, held.Cents, ok, tc.cents, tc.ok)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/boltdb/bolt"
 
@@ -20,16 +21,23 @@ var ErrInsufficientFunds = fmt.Errorf("insufficient funds")
 
 type LedgerEntry struct {
 	TxID    snowflake.Snowflake
+	Time    time.Time
 	Cents   Cents
 	Balance Cents
 	From    proto.UserID
 	To      proto.UserID
 	Memo    string
+	Refunds snowflake.Snowflake `json:",omitempty"`
 }
 
 type Advertiser struct {
-	Nick    string
-	Balance Cents
+	Nick        string
+	Balance     Cents
+	Promo       Cents
+	PromoLots   []PromoLot
+	CreditLimit Cents
+	Paused      bool
+	TimeZone    string
 }
 
 func getBalance(tx *Tx, userID proto.UserID) (Cents, error) {
@@ -60,7 +68,7 @@ func getBalance(tx *Tx, userID proto.UserID) (Cents, error) {
 			}
 			stimulus := Cents(c)
 			if tx.Writable() {
-				_, balance, err := transfer(tx, stimulus, House, userID, "euphoria commercial speech stimulus", true)
+				_, balance, _, err := transfer(tx, stimulus, House, userID, "euphoria commercial speech stimulus", true)
 				return balance, err
 			}
 			return stimulus, nil
@@ -81,12 +89,30 @@ func GetAdvertiser(db *DB, userID proto.UserID) (*Advertiser, error) {
 		if b == nil {
 			return nil
 		}
-		cents, err := getBalance(tx, userID)
+		now := tx.db.Clock()
+		cents, err := unexpiredBalance(tx, userID, now)
+		if err != nil {
+			return err
+		}
+		limit, err := getCreditLimit(tx, userID)
+		if err != nil {
+			return err
+		}
+		lots, err := promoLots(tx, userID)
 		if err != nil {
 			return err
 		}
 		advertiser.Nick = string(b.Get([]byte("nick")))
 		advertiser.Balance = cents
+		for _, lot := range lots {
+			if now.Before(lot.Expires) {
+				advertiser.PromoLots = append(advertiser.PromoLots, lot)
+				advertiser.Promo += lot.Remaining
+			}
+		}
+		advertiser.CreditLimit = limit
+		advertiser.Paused = creditPaused(tx, userID)
+		advertiser.TimeZone = string(b.Get([]byte("timezone")))
 		return nil
 	})
 	return advertiser, err
@@ -102,7 +128,7 @@ func SetNick(db *DB, userID proto.UserID, nick string) error {
 	})
 }
 
-func transfer(tx *Tx, cents Cents, from, to proto.UserID, memo string, force bool) (fromBalance, toBalance Cents, err error) {
+func transfer(tx *Tx, cents Cents, from, to proto.UserID, memo string, force bool) (fromBalance, toBalance Cents, txID snowflake.Snowflake, err error) {
 	fromBucket, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(from))
 	if err != nil {
 		return
@@ -137,17 +163,25 @@ func transfer(tx *Tx, cents Cents, from, to proto.UserID, memo string, force boo
 
 	fromBalance -= cents
 	toBalance += cents
-	if fromBalance < 0 && !force && from != House && from != System {
-		err = ErrInsufficientFunds
-		return
+	if !force && !creditExempt(from) {
+		var promo Cents
+		if promo, err = promoBalance(tx, from); err != nil {
+			return
+		}
+		if fromBalance-promo < 0 {
+			err = ErrInsufficientFunds
+			return
+		}
 	}
 
-	txID, err := snowflake.New()
+	txID, err = snowflake.New()
 	if err != nil {
 		return
 	}
+	now := tx.db.Clock()
 	fromEntry := LedgerEntry{
 		TxID:    txID,
+		Time:    now,
 		Cents:   cents,
 		From:    from,
 		To:      to,
@@ -160,6 +194,7 @@ func transfer(tx *Tx, cents Cents, from, to proto.UserID, memo string, force boo
 	}
 	toEntry := LedgerEntry{
 		TxID:    txID,
+		Time:    now,
 		Cents:   cents,
 		From:    from,
 		To:      to,
@@ -175,49 +210,26 @@ func transfer(tx *Tx, cents Cents, from, to proto.UserID, memo string, force boo
 	fromLedger.Put([]byte(txID.String()), fromEntryBytes)
 	toBucket.Put([]byte("balance"), []byte(fmt.Sprintf("%d", toBalance)))
 	toLedger.Put([]byte(txID.String()), toEntryBytes)
+	err = resumeForCredit(tx, to, toBalance)
 	return
 }
 
 func Transfer(db *DB, cents Cents, from, to proto.UserID, memo string, force ...bool) (fromBalance, toBalance Cents, err error) {
 	err = db.Update(func(tx *Tx) error {
 		var err error
-		fromBalance, toBalance, err = transfer(tx, cents, from, to, memo, len(force) > 0 && force[0])
+		fromBalance, toBalance, _, err = transfer(tx, cents, from, to, memo, len(force) > 0 && force[0])
 		return err
 	})
 	return
 }
 
 func Ledger(db *DB, userID proto.UserID, maxEntries int) ([]LedgerEntry, error) {
-	entries := []LedgerEntry{}
-	err := db.View(func(tx *Tx) error {
-		b := tx.AdvertiserBucket().Bucket([]byte(userID))
-		if b != nil {
-			fmt.Printf("looking up ledger\n")
-			b = b.Bucket([]byte("ledger"))
-		}
-		if b == nil {
-			fmt.Printf("no ledger\n")
-			return nil
-		}
-		fmt.Printf("trying cursor\n")
-		c := b.Cursor()
-		for k, v := c.Last(); k != nil && len(entries) < maxEntries; k, v = c.Prev() {
-			entry := LedgerEntry{}
-			if err := json.Unmarshal(v, &entry); err != nil {
-				return err
-			}
-			entries = append(entries, entry)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
+	return LedgerBefore(db, userID, "", maxEntries)
+}
 
-	for i := 0; i < len(entries)/2; i++ {
-		entries[i], entries[len(entries)-i-1] = entries[len(entries)-i-1], entries[i]
-	}
-	return entries, nil
+func LedgerBefore(db *DB, userID proto.UserID, before string, maxEntries int) ([]LedgerEntry, error) {
+	entries, _, err := QueryLedger(db, LedgerFilter{UserID: userID}, before, maxEntries)
+	return entries, err
 }
 
 func ResetBalances(db *DB) error {
@@ -227,10 +239,11 @@ func ResetBalances(db *DB) error {
 			if v == nil {
 				b := userBuckets.Bucket(k)
 				b.Delete([]byte("balance"))
-				lb := b.Bucket([]byte("ledger"))
-				if lb != nil {
-					if err := b.DeleteBucket([]byte("ledger")); err != nil {
-						return err
+				for _, name := range []string{"ledger", "promo", "promoused"} {
+					if b.Bucket([]byte(name)) != nil {
+						if err := b.DeleteBucket([]byte(name)); err != nil {
+							return err
+						}
 					}
 				}
 			}
@@ -239,41 +252,23 @@ func ResetBalances(db *DB) error {
 		if err != nil {
 			return err
 		}
-		if err := tx.DeleteBucket([]byte("metrics")); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucket([]byte("metrics")); err != nil {
-			return err
+		for _, bucket := range []string{"metrics", "creativemetrics", "charge", "refund"} {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(bucket)); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 }
 
-func AddStimulus(db *DB, amount Cents) error {
+func AddStimulus(db *DB, amount Cents, expiry time.Duration) error {
 	return db.Update(func(tx *Tx) error {
-		b := tx.StimulusBucket()
-		former := Cents(0)
-		bs := b.Get([]byte("stimulus"))
-		if bs != nil {
-			c, err := strconv.ParseInt(string(bs), 10, 64)
-			if err != nil {
-				return err
-			}
-			former = Cents(c)
+		if expiry > 0 {
+			return stimulate(tx, amount, expiry, "euphoria commercial speech stimulus (promotional)")
 		}
-		b.Put([]byte("stimulus"), []byte(fmt.Sprintf("%d", former+amount)))
-
-		memo := "euphoria commercial speech stimulus refresher"
-		c := tx.AdvertiserBucket().Cursor()
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			userID := proto.UserID(k)
-			if userID == House || userID == System {
-				continue
-			}
-			if _, _, err := transfer(tx, amount, House, userID, memo, true); err != nil {
-				return err
-			}
-		}
-		return nil
+		return stimulate(tx, amount, 0, "euphoria commercial speech stimulus refresher")
 	})
 }
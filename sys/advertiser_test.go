@@ -0,0 +1,44 @@
+package sys
+
+import (
+	"testing"
+
+	"euphoria.io/heim/proto"
+)
+
+func TestTransferBetweenAdvertisers(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if _, _, err := Transfer(db, 500, House, "account:a", "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		cents    Cents
+		from, to proto.UserID
+		err      error
+		a, b     Cents
+	}{
+		{"transfer", 200, "account:a", "account:b", nil, 300, 200},
+		{"overdraw", 301, "account:a", "account:b", ErrInsufficientFunds, 300, 200},
+		{"drain", 300, "account:a", "account:b", nil, 0, 500},
+		{"return", 100, "account:b", "account:a", nil, 100, 400},
+	}
+	for _, tc := range cases {
+		a, b, err := Transfer(db, tc.cents, tc.from, tc.to, "", false)
+		if err != tc.err {
+			t.Fatalf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if tc.from == "account:b" {
+			a, b = b, a
+		}
+		if a != tc.a || b != tc.b {
+			t.Errorf("%s: balances %s and %s, expected %s and %s", tc.name, a, b, tc.a, tc.b)
+		}
+	}
+}
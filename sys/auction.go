@@ -0,0 +1,72 @@
+package sys
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	SecondPriceAuction            = "second-price"
+	FirstPriceAuction             = "first-price"
+	GeneralizedSecondPriceAuction = "gsp"
+)
+
+type Award struct {
+	Bid
+	Cost Cents
+}
+
+type Auctioneer interface {
+	Auction(bids BidList) []Award
+}
+
+func NewAuctioneer(mechanism string, slots int) (Auctioneer, error) {
+	switch mechanism {
+	case SecondPriceAuction:
+		return SecondPrice{}, nil
+	case FirstPriceAuction:
+		return FirstPrice{}, nil
+	case GeneralizedSecondPriceAuction:
+		if slots < 1 {
+			return nil, fmt.Errorf("invalid number of slots: %d", slots)
+		}
+		return GeneralizedSecondPrice{Slots: slots}, nil
+	default:
+		return nil, fmt.Errorf("unknown auction mechanism: %s", mechanism)
+	}
+}
+
+type SecondPrice struct{}
+
+func (SecondPrice) Auction(bl BidList) []Award {
+	return GeneralizedSecondPrice{Slots: 1}.Auction(bl)
+}
+
+type FirstPrice struct{}
+
+func (FirstPrice) Auction(bl BidList) []Award {
+	if len(bl) == 0 {
+		return nil
+	}
+	sort.Stable(sort.Reverse(bl))
+	return []Award{{Bid: bl[0], Cost: Cents(float64(bl[0].Bid) * bl[0].Discount)}}
+}
+
+type GeneralizedSecondPrice struct {
+	Slots int
+}
+
+func (gsp GeneralizedSecondPrice) Auction(bl BidList) []Award {
+	sort.Stable(sort.Reverse(bl))
+	awards := []Award{}
+	for i := 0; i < len(bl) && i < gsp.Slots; i++ {
+		award := Award{Bid: bl[i]}
+		if i+1 < len(bl) {
+			award.Cost = Cents(float64(bl[i+1].Bid+1) * bl[i].Discount)
+		} else {
+			award.Cost = Cents(float64(bl[i].Bid) * bl[i].Discount)
+		}
+		awards = append(awards, award)
+	}
+	return awards
+}
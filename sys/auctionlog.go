@@ -0,0 +1,145 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+type AuctionRecord struct {
+	ID      snowflake.Snowflake
+	Time    time.Time
+	Room    string
+	Words   WordSeq
+	MinBid  Cents
+	Bids    []BidRecord
+	Awards  []AwardRecord
+	Skipped string `json:",omitempty"`
+}
+
+type BidRecord struct {
+	UserID       proto.UserID
+	CreativeName string
+	Matches      []string
+	Score        float64
+	Discount     float64
+	MaxBid       Cents
+	Bid          Cents
+	Outcome      string
+}
+
+type AwardRecord struct {
+	UserID       proto.UserID
+	CreativeName string
+	Creative     string `json:",omitempty"`
+	Cost         Cents
+	TxID         snowflake.Snowflake `json:",omitempty"`
+}
+
+func newAuctionRecord(roomName string, words WordSeq, minBid Cents, now time.Time, bids BidList, awards []Award) (*AuctionRecord, error) {
+	id, err := snowflake.New()
+	if err != nil {
+		return nil, err
+	}
+	record := &AuctionRecord{
+		ID:     id,
+		Time:   now,
+		Room:   roomName,
+		Words:  words,
+		MinBid: minBid,
+		Bids:   make([]BidRecord, 0, len(bids)),
+		Awards: make([]AwardRecord, 0, len(awards)),
+	}
+
+	won := map[string]bool{}
+	for _, award := range awards {
+		won[fmt.Sprintf("%s:%s", award.UserID, award.CreativeName)] = true
+		record.Awards = append(record.Awards, AwardRecord{
+			UserID:       award.UserID,
+			CreativeName: award.CreativeName,
+			Cost:         award.Cost,
+		})
+	}
+	for _, bid := range bids {
+		matches := []string{}
+		for w, _ := range bid.Matches {
+			matches = append(matches, w)
+		}
+		outcome := "outbid"
+		if won[fmt.Sprintf("%s:%s", bid.UserID, bid.CreativeName)] {
+			outcome = "won"
+		}
+		record.Bids = append(record.Bids, BidRecord{
+			UserID:       bid.UserID,
+			CreativeName: bid.CreativeName,
+			Matches:      matches,
+			Score:        bid.Score,
+			Discount:     bid.Discount,
+			MaxBid:       bid.MaxBid,
+			Bid:          bid.Bid,
+			Outcome:      outcome,
+		})
+	}
+	return record, nil
+}
+
+func (r *AuctionRecord) skipBid(userID proto.UserID, creativeName, reason string) {
+	for i, bid := range r.Bids {
+		if bid.UserID == userID && bid.CreativeName == creativeName {
+			r.Bids[i].Outcome = "skipped: " + reason
+		}
+	}
+}
+
+func (r *AuctionRecord) save(tx *Tx) error {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return tx.AuctionBucket().Put([]byte(r.ID.String()), encoded)
+}
+
+func loadAuctionRecord(tx *Tx, id string) (*AuctionRecord, error) {
+	encoded := tx.AuctionBucket().Get([]byte(id))
+	if encoded == nil {
+		return nil, nil
+	}
+	record := &AuctionRecord{}
+	if err := json.Unmarshal(encoded, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func GetAuction(db *DB, id string) (record *AuctionRecord, err error) {
+	err = db.View(func(tx *Tx) error {
+		record, err = loadAuctionRecord(tx, id)
+		return err
+	})
+	return
+}
+
+func Auctions(db *DB, roomName string, maxEntries int) ([]AuctionRecord, error) {
+	records := []AuctionRecord{}
+	err := db.View(func(tx *Tx) error {
+		c := tx.AuctionBucket().Cursor()
+		for k, v := c.Last(); k != nil && len(records) < maxEntries; k, v = c.Prev() {
+			record := AuctionRecord{}
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if roomName != "" && record.Room != roomName {
+				continue
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,177 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"euphoria.io/heim/proto"
+)
+
+type AuditReport struct {
+	Accounts     int
+	Transactions int
+	Spends       int
+	Total        Cents
+	Problems     []string
+}
+
+func (r *AuditReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+type auditSide struct {
+	userID proto.UserID
+	entry  LedgerEntry
+}
+
+func Audit(db *DB) (*AuditReport, error) {
+	report := &AuditReport{}
+	err := db.View(func(tx *Tx) error {
+		if err := auditLedgers(tx, report); err != nil {
+			return err
+		}
+		return auditSpends(tx, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func auditLedgers(tx *Tx, report *AuditReport) error {
+	ab := tx.AdvertiserBucket()
+	if ab == nil {
+		return nil
+	}
+
+	txs := map[string][]auditSide{}
+	err := ab.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		userID := proto.UserID(k)
+		b := ab.Bucket(k)
+		bs := b.Get([]byte("balance"))
+		lb := b.Bucket([]byte("ledger"))
+		if bs == nil && lb == nil {
+			return nil
+		}
+		report.Accounts++
+
+		var stored Cents
+		if bs != nil {
+			c, err := strconv.ParseInt(string(bs), 10, 64)
+			if err != nil {
+				report.problem("%s: unparseable balance %q", userID, bs)
+				return nil
+			}
+			stored = Cents(c)
+		}
+		report.Total += stored
+
+		var replayed Cents
+		if lb != nil {
+			err := lb.ForEach(func(k, v []byte) error {
+				entry := LedgerEntry{}
+				if err := json.Unmarshal(v, &entry); err != nil {
+					report.problem("%s: unparseable ledger entry %s: %s", userID, k, err)
+					return nil
+				}
+				if entry.TxID.String() != string(k) {
+					report.problem("%s: ledger entry %s is stored under key %s", userID, entry.TxID, k)
+				}
+				if entry.From == userID {
+					replayed -= entry.Cents
+				}
+				if entry.To == userID {
+					replayed += entry.Cents
+				}
+				if entry.From != userID && entry.To != userID {
+					report.problem("%s: ledger entry %s is between %s and %s", userID, entry.TxID, entry.From, entry.To)
+				}
+				if entry.Balance != replayed {
+					report.problem("%s: ledger entry %s records balance %s, replay gives %s",
+						userID, entry.TxID, entry.Balance, replayed)
+					replayed = entry.Balance
+				}
+				txs[string(k)] = append(txs[string(k)], auditSide{userID, entry})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if replayed != stored {
+			report.problem("%s: stored balance %s does not match ledger balance %s", userID, stored, replayed)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	txIDs := make([]string, 0, len(txs))
+	for txID, _ := range txs {
+		txIDs = append(txIDs, txID)
+	}
+	sort.Strings(txIDs)
+	for _, txID := range txIDs {
+		sides := txs[txID]
+		report.Transactions++
+		first := sides[0].entry
+		expected := map[proto.UserID]bool{first.From: false, first.To: false}
+		for _, side := range sides {
+			e := side.entry
+			if e.Cents != first.Cents || e.From != first.From || e.To != first.To || e.Memo != first.Memo {
+				report.problem("tx %s: %s's entry (%s from %s to %s) differs from %s's (%s from %s to %s)",
+					txID, side.userID, e.Cents, e.From, e.To, sides[0].userID, first.Cents, first.From, first.To)
+			}
+			if _, ok := expected[side.userID]; ok {
+				expected[side.userID] = true
+			}
+		}
+		for userID, found := range expected {
+			if !found {
+				report.problem("tx %s: missing from %s's ledger", txID, userID)
+			}
+		}
+	}
+
+	if report.Total != 0 {
+		report.problem("balances sum to %s instead of $0", report.Total)
+	}
+	return nil
+}
+
+func auditSpends(tx *Tx, report *AuditReport) error {
+	sb := tx.SpendBucket()
+	if sb == nil {
+		return nil
+	}
+	return sb.ForEach(func(k, v []byte) error {
+		spend := Spend{}
+		if err := json.Unmarshal(v, &spend); err != nil {
+			report.problem("spend %s: %s", k, err)
+			return nil
+		}
+		report.Spends++
+		names := []string{spend.CreativeName}
+		for _, wc := range spend.Creatives {
+			if wc.Name != spend.CreativeName {
+				names = append(names, wc.Name)
+			}
+		}
+		for _, name := range names {
+			creative, err := getCreative(tx, spend.UserID, name)
+			if err != nil {
+				return err
+			}
+			if creative == &MissingCreative {
+				report.problem("spend %s: creative %s by %s is missing", k, name, spend.UserID)
+			}
+		}
+		return nil
+	})
+}
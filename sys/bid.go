@@ -1,18 +1,19 @@
 package sys
 
 import (
-	"encoding/json"
 	"fmt"
-	"sort"
+	"time"
 
 	"euphoria.io/heim/proto"
 )
 
 type Bid struct {
 	Spend
-	Matches  WordList
-	Discount float64
-	Bid      Cents
+	Matches        WordList
+	Score          float64
+	Discount       float64
+	EngagementRate float64
+	Bid            Cents
 }
 
 type BidList []Bid
@@ -21,35 +22,61 @@ func (bl BidList) Len() int           { return len(bl) }
 func (bl BidList) Swap(i, j int)      { bl[i], bl[j] = bl[j], bl[i] }
 func (bl BidList) Less(i, j int) bool { return bl[i].Bid < bl[j].Bid }
 
-func getBids(tx *Tx, target WordList, minBid Cents) (BidList, error) {
-	userOverrides, err := userOverrides(tx)
-	if err != nil {
-		return nil, err
-	}
-
-	spendOverrides, err := spendOverrides(tx)
-	if err != nil {
-		return nil, err
+func getBids(tx *Tx, spends []Spend, roomName string, words WordSeq, minBid Cents, now time.Time, reject func(Bid, string)) (BidList, error) {
+	drop := func(bid Bid, format string, args ...interface{}) {
+		if reject != nil {
+			reject(bid, fmt.Sprintf(format, args...))
+		}
 	}
 
+	target := words.WordList()
 	bids := BidList{}
 	balances := map[proto.UserID]Cents{}
+	locations := map[proto.UserID]*time.Location{}
 	matchCounts := map[string]int{}
 
-	c := tx.SpendBucket().Cursor()
-	for k, v := c.First(); k != nil; k, v = c.Next() {
-		bid := Bid{}
-		if err := json.Unmarshal(v, &bid.Spend); err != nil {
-			return nil, err
+	for _, spend := range spends {
+		bid := Bid{Spend: spend}
+		if ok, reason := tx.db.index.Enabled(bid.Spend); !ok {
+			drop(bid, reason)
+			continue
+		}
+		loc, ok := locations[bid.UserID]
+		if !ok {
+			var err error
+			if loc, err = getLocation(tx, bid.UserID); err != nil {
+				return nil, err
+			}
+			locations[bid.UserID] = loc
 		}
-		if enabled, ok := spendOverrides[bid.UserID][bid.CreativeName]; ok && !enabled {
+		if running, reason := bid.runningAt(now, loc); !running {
+			drop(bid, reason)
 			continue
 		}
-		if enabled, ok := userOverrides[bid.UserID]; ok && !enabled {
+		if !bid.TargetsRoom(roomName) {
+			drop(bid, "not targeting &%s", roomName)
+			continue
+		}
+		if negative := target.Match(bid.Negative); len(negative) > 0 {
+			drop(bid, "negative keyword %s", negative)
+			continue
+		}
+		available, err := bid.uncappedCreatives(tx, roomName, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(available) == 0 {
+			drop(bid, "frequency cap of %s reached in &%s", bid.frequencyCap(tx.db.CreativeCap), roomName)
 			continue
 		}
 		bid.Matches = target.Match(bid.Keywords)
+		for _, phrase := range bid.Phrases {
+			if phrase.Match(words) {
+				bid.Matches[phrase.String()] = struct{}{}
+			}
+		}
 		if len(bid.Matches) == 0 {
+			drop(bid, "no matching keywords")
 			continue
 		}
 		for w, _ := range bid.Matches {
@@ -64,62 +91,74 @@ func getBids(tx *Tx, target WordList, minBid Cents) (BidList, error) {
 		for w, _ := range bid.Matches {
 			scores[i] += 1 / float64(matchCounts[w])
 		}
-		scores[i] *= float64(len(bid.Matches)) / float64(len(bid.Keywords))
+		scores[i] *= float64(len(bid.Matches)) / float64(len(bid.Keywords)+len(bid.Phrases))
 		if minScore < 0 || scores[i] < minScore {
 			minScore = scores[i]
 		}
 	}
 
 	for i, _ := range bids {
+		bids[i].Score = scores[i]
 		bids[i].Discount = minScore / scores[i]
 	}
 
 	candidates := bids
 	bids = make([]Bid, 0, len(bids))
 	for _, bid := range candidates {
-		b, ok := balances[bid.UserID]
-		if !ok {
-			cents, err := getBalance(tx, bid.UserID)
-			if err != nil {
-				return nil, err
+		if creditPaused(tx, bid.UserID) {
+			drop(bid, "advertiser paused at credit limit")
+			continue
+		}
+		if !creditExempt(bid.UserID) {
+			b, ok := balances[bid.UserID]
+			if !ok {
+				cents, err := availableFunds(tx, bid.UserID)
+				if err != nil {
+					return nil, err
+				}
+				balances[bid.UserID] = cents
+				b = cents
+			}
+			if b < Cents(float64(minBid)*bid.Discount) {
+				drop(bid, "available funds of %s are below discounted minimum bid", b)
+				continue
+			}
+			if bid.MaxBid > b {
+				bid.MaxBid = b
 			}
-			fmt.Printf("user %s has budget %s\n", bid.UserID, cents)
-			balances[bid.UserID] = cents
-			b = cents
 		}
-		if b < Cents(float64(minBid)*bid.Discount) && bid.UserID != House {
-			continue
+		usage, err := loadBudgetUsage(tx, bid.UserID, bid.CreativeName, now)
+		if err != nil {
+			return nil, err
 		}
-		if bid.MaxBid > b && bid.UserID != House {
-			bid.MaxBid = b
+		if remaining, capped := bid.budgetRemaining(usage, now); capped {
+			if remaining <= 0 {
+				drop(bid, "budget cap reached for now")
+				continue
+			}
+			if bid.MaxBid > remaining {
+				bid.MaxBid = remaining
+			}
 		}
-		if bid.MaxBid < minBid {
+		maxBid := bid.MaxBid
+		if bid.Billing == EngagementBilling {
+			if bid.EngagementRate, err = bid.engagementRate(tx); err != nil {
+				return nil, err
+			}
+			maxBid = Cents(float64(bid.MaxBid) * bid.EngagementRate)
+			if maxBid < minBid {
+				drop(bid, "expected value of %s (%.1f%% engagement at %s) is below minimum bid of %s",
+					maxBid, 100*bid.EngagementRate, bid.MaxBid, minBid)
+				continue
+			}
+		}
+		if maxBid < minBid {
+			drop(bid, "max bid of %s is below minimum bid of %s", bid.MaxBid, minBid)
 			continue
 		}
-		bid.Bid = Cents(float64(bid.MaxBid) / bid.Discount)
+		bid.Bid = Cents(float64(maxBid) / bid.Discount)
 		bids = append(bids, bid)
 	}
 
 	return bids, nil
 }
-
-func (bl BidList) Auction() (spend Spend, cost Cents, ok bool) {
-	fmt.Printf("options:\n")
-	for _, bid := range bl {
-		fmt.Printf("%#v\n", bid)
-	}
-	switch len(bl) {
-	case 0:
-		return
-	case 1:
-		spend = bl[0].Spend
-		cost = Cents(float64(bl[0].Bid) * bl[0].Discount)
-		ok = true
-	default:
-		sort.Sort(sort.Reverse(bl))
-		spend = bl[0].Spend
-		cost = Cents(float64(bl[1].Bid+1) * bl[0].Discount)
-		ok = true
-	}
-	return
-}
@@ -0,0 +1,92 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"euphoria.io/heim/proto"
+)
+
+const PacingSlack = time.Hour
+
+type BudgetUsage struct {
+	Day      string
+	Daily    Cents
+	Lifetime Cents
+}
+
+func budgetDay(now time.Time) string { return now.UTC().Format("2006-01-02") }
+
+func loadBudgetUsage(tx *Tx, userID proto.UserID, creativeName string, now time.Time) (BudgetUsage, error) {
+	usage := BudgetUsage{}
+	globalKey := fmt.Sprintf("%s:%s", userID, creativeName)
+	encoded := tx.BudgetBucket().Get([]byte(globalKey))
+	if encoded != nil {
+		if err := json.Unmarshal(encoded, &usage); err != nil {
+			return usage, err
+		}
+	}
+	if day := budgetDay(now); usage.Day != day {
+		usage.Day = day
+		usage.Daily = 0
+	}
+	return usage, nil
+}
+
+func recordBudgetUsage(tx *Tx, userID proto.UserID, creativeName string, cost Cents, now time.Time) error {
+	usage, err := loadBudgetUsage(tx, userID, creativeName, now)
+	if err != nil {
+		return err
+	}
+	usage.Daily += cost
+	usage.Lifetime += cost
+	return saveBudgetUsage(tx, userID, creativeName, usage)
+}
+
+func saveBudgetUsage(tx *Tx, userID proto.UserID, creativeName string, usage BudgetUsage) error {
+	encoded, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	globalKey := fmt.Sprintf("%s:%s", userID, creativeName)
+	return tx.BudgetBucket().Put([]byte(globalKey), encoded)
+}
+
+func GetBudgetUsage(db *DB, userID proto.UserID, creativeName string) (usage BudgetUsage, err error) {
+	err = db.View(func(tx *Tx) error {
+		var err error
+		usage, err = loadBudgetUsage(tx, userID, creativeName, db.Clock())
+		return err
+	})
+	return
+}
+
+func pacedDailyBudget(dailyCap Cents, now time.Time) Cents {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	elapsed := now.Sub(midnight) + PacingSlack
+	if elapsed >= 24*time.Hour {
+		return dailyCap
+	}
+	return Cents(float64(dailyCap) * float64(elapsed) / float64(24*time.Hour))
+}
+
+func (s *Spend) budgetRemaining(usage BudgetUsage, now time.Time) (Cents, bool) {
+	var (
+		remaining Cents
+		capped    bool
+	)
+	if s.LifetimeCap > 0 {
+		remaining = s.LifetimeCap - usage.Lifetime
+		capped = true
+	}
+	if s.DailyCap > 0 {
+		daily := pacedDailyBudget(s.DailyCap, now) - usage.Daily
+		if !capped || daily < remaining {
+			remaining = daily
+		}
+		capped = true
+	}
+	return remaining, capped
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
 )
 
 var MissingCreative = Creative{
@@ -69,13 +71,13 @@ func DeleteCreative(db *DB, userID proto.UserID, name string) (deleted bool, err
 func Creatives(db *DB, userID proto.UserID) ([]Creative, error) {
 	creatives := []Creative{}
 	err := db.View(func(tx *Tx) error {
-		b, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
-		if err != nil {
-			return err
+		b := tx.AdvertiserBucket().Bucket([]byte(userID))
+		if b == nil {
+			return nil
 		}
-		cs, err := b.CreateBucketIfNotExists([]byte("creatives"))
-		if err != nil {
-			return err
+		cs := b.Bucket([]byte("creatives"))
+		if cs == nil {
+			return nil
 		}
 		return cs.ForEach(func(k, v []byte) error {
 			creative := Creative{}
@@ -90,19 +92,117 @@ func Creatives(db *DB, userID proto.UserID) ([]Creative, error) {
 }
 
 type Spend struct {
-	UserID       proto.UserID
-	CreativeName string
-	MaxBid       Cents
-	Keywords     WordList
+	UserID        proto.UserID
+	CreativeName  string
+	MaxBid        Cents
+	DailyCap      Cents              `json:",omitempty"`
+	LifetimeCap   Cents              `json:",omitempty"`
+	Rooms         []string           `json:",omitempty"`
+	ExcludeRooms  []string           `json:",omitempty"`
+	FrequencyCap  *FrequencyCap      `json:",omitempty"`
+	Start         *time.Time         `json:",omitempty"`
+	End           *time.Time         `json:",omitempty"`
+	Schedule      *Schedule          `json:",omitempty"`
+	Creatives     []WeightedCreative `json:",omitempty"`
+	Rotation      string             `json:",omitempty"`
+	Billing       string             `json:",omitempty"`
+	EngagementCap int                `json:",omitempty"`
+	Keywords      WordList
+	Phrases       []Phrase `json:",omitempty"`
+	Negative      WordList `json:",omitempty"`
 }
 
-func NewSpend(db *DB, userID proto.UserID, creativeName, keywords string, maxBid Cents) (spend *Spend, replaced bool, err error) {
-	spend = &Spend{
-		UserID:       userID,
-		CreativeName: creativeName,
-		MaxBid:       maxBid,
-		Keywords:     ParseWordList(keywords),
+func (s *Spend) TargetsRoom(roomName string) bool {
+	for _, excluded := range s.ExcludeRooms {
+		if excluded == roomName {
+			return false
+		}
+	}
+	if len(s.Rooms) == 0 {
+		return true
+	}
+	for _, included := range s.Rooms {
+		if included == roomName {
+			return true
+		}
+	}
+	return false
+}
+
+func NormalizeRooms(roomNames []string) []string {
+	rooms := []string{}
+	for _, roomName := range roomNames {
+		roomName = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(roomName), "&"))
+		if roomName != "" {
+			rooms = append(rooms, roomName)
+		}
+	}
+	return rooms
+}
+
+func (s *Spend) Validate() error {
+	if s.CreativeName == "" {
+		return fmt.Errorf("missing creative")
+	}
+	if s.MaxBid <= 0 {
+		return fmt.Errorf("max bid must be positive")
+	}
+	if s.DailyCap < 0 || s.LifetimeCap < 0 {
+		return fmt.Errorf("budget caps can't be negative")
+	}
+	s.Rooms = NormalizeRooms(s.Rooms)
+	s.ExcludeRooms = NormalizeRooms(s.ExcludeRooms)
+	if len(s.Rooms) == 0 {
+		s.Rooms = nil
+	}
+	if len(s.ExcludeRooms) == 0 {
+		s.ExcludeRooms = nil
 	}
+	if fc := s.FrequencyCap; fc != nil && (fc.Count < 1 || fc.Window <= 0) {
+		return fmt.Errorf("frequency cap count and window must be positive")
+	}
+	if fc := s.FrequencyCap; fc != nil && fc.Window > MaxFrequencyWindow {
+		return fmt.Errorf("frequency cap window can't be longer than %s", MaxFrequencyWindow)
+	}
+	if s.Start != nil && s.End != nil && !s.Start.Before(*s.End) {
+		return fmt.Errorf("start must be before end")
+	}
+	for _, wc := range s.Creatives {
+		if wc.Name == "" {
+			return fmt.Errorf("missing creative name in rotation")
+		}
+		if wc.Weight <= 0 {
+			return fmt.Errorf("invalid weight for %s", wc.Name)
+		}
+	}
+	switch s.Rotation {
+	case "":
+		if len(s.Creatives) > 0 {
+			s.Rotation = WeightedRotation
+		}
+	case WeightedRotation, BanditRotation:
+	default:
+		return fmt.Errorf("invalid rotation: %s", s.Rotation)
+	}
+	switch s.Billing {
+	case "", EngagementBilling:
+	case ImpressionBilling:
+		s.Billing = ""
+	default:
+		return fmt.Errorf("invalid billing: %s", s.Billing)
+	}
+	if s.EngagementCap < 0 {
+		return fmt.Errorf("engagement cap can't be negative")
+	}
+	if len(s.Keywords) == 0 && len(s.Phrases) == 0 {
+		return fmt.Errorf("spend needs at least one keyword or phrase")
+	}
+	return nil
+}
+
+func NewSpend(db *DB, spend *Spend) (replaced bool, err error) {
+	userID := spend.UserID
+	creativeName := spend.CreativeName
 	err = db.Update(func(tx *Tx) error {
 		b, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
 		if err != nil {
@@ -123,6 +223,7 @@ func NewSpend(db *DB, userID proto.UserID, creativeName, keywords string, maxBid
 
 		globalKey := fmt.Sprintf("%s:%s", userID, creativeName)
 		tx.SpendBucket().Put([]byte(globalKey), encoded)
+		tx.OnCommit(func() { tx.db.index.Put(*spend) })
 		return nil
 	})
 	return
@@ -145,6 +246,8 @@ func DeleteSpend(db *DB, userID proto.UserID, creativeName string) (deleted bool
 
 		globalKey := fmt.Sprintf("%s:%s", userID, creativeName)
 		tx.SpendBucket().Delete([]byte(globalKey))
+		tx.BudgetBucket().Delete([]byte(globalKey))
+		tx.OnCommit(func() { tx.db.index.Remove(userID, creativeName) })
 		return nil
 	})
 	return
@@ -195,6 +298,7 @@ func ScaleSpends(db *DB, userID proto.UserID, factor float64) error {
 		if ss == nil {
 			return nil
 		}
+		scaled := []Spend{}
 		c := ss.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			spend := Spend{}
@@ -211,77 +315,187 @@ func ScaleSpends(db *DB, userID proto.UserID, factor float64) error {
 
 			globalKey := fmt.Sprintf("%s:%s", userID, spend.CreativeName)
 			tx.SpendBucket().Put([]byte(globalKey), v)
+			scaled = append(scaled, spend)
 		}
+		tx.OnCommit(func() { tx.db.index.Put(scaled...) })
 		return nil
 	})
 }
 
-func Select(db *DB, content string, minBid Cents) (*Creative, Cents, error) {
-	var (
-		creative *Creative
-		cost     Cents
-	)
+type Selection struct {
+	AuctionID       snowflake.Snowflake
+	Creative        *Creative
+	Spend           Spend
+	Cost            Cents
+	EngagementPrice Cents
+	EngagementRate  float64
+	Matches         WordList
+}
 
-	words := ParseWordList(content)
-	wl := []string{}
-	for w, _ := range words {
-		wl = append(wl, w)
+func (s Selection) ExpectedCost() Cents {
+	if s.EngagementPrice == 0 {
+		return s.Cost
+	}
+	engagements := s.EngagementRate
+	if limit := float64(s.Spend.engagementCap()); engagements > limit {
+		engagements = limit
 	}
-	fmt.Printf("auctioning %s at min bid %s\n", strings.Join(wl, ", "), minBid)
+	return Cents(float64(s.EngagementPrice) * engagements)
+}
 
-	err := db.View(func(tx *Tx) error {
-		bids, err := getBids(tx, words, minBid)
+func Select(db *DB, roomName, content string, minBid Cents, impressions int) ([]Selection, error) {
+	selections := []Selection{}
+
+	now := db.Clock()
+	words := ParseWordSeq(content)
+
+	err := db.Update(func(tx *Tx) error {
+		remaining, capped, err := roomAdsRemaining(tx, roomName, db.RoomCap, now)
 		if err != nil {
 			return err
 		}
-
-		winner, c, ok := bids.Auction()
-		if !ok {
-			return nil
+		if capped && remaining == 0 {
+			record, err := newAuctionRecord(roomName, words, minBid, now, nil, nil)
+			if err != nil {
+				return err
+			}
+			record.Skipped = fmt.Sprintf("room cap of %d ads per hour reached", db.RoomCap)
+			return record.save(tx)
 		}
-		cost = c
 
-		b := tx.AdvertiserBucket().Bucket([]byte(winner.UserID))
-		if b == nil {
-			creative = &MissingCreative
-			return nil
-		}
-		b = b.Bucket([]byte("creatives"))
-		if b == nil {
-			creative = &MissingCreative
-			return nil
+		bids, err := getBids(tx, tx.db.index.Lookup(words), roomName, words, minBid, now, nil)
+		if err != nil {
+			return err
 		}
-		encoded := b.Get([]byte(winner.CreativeName))
-		if encoded == nil {
-			creative = &MissingCreative
-			return nil
+
+		awards := db.Auctioneer.Auction(bids)
+		if capped && len(awards) > remaining {
+			awards = awards[:remaining]
 		}
-		creative = new(Creative)
-		if err := json.Unmarshal(encoded, creative); err != nil {
+		record, err := newAuctionRecord(roomName, words, minBid, now, bids, awards)
+		if err != nil {
 			return err
 		}
-		return nil
+
+		billed := make([]AwardRecord, 0, len(awards))
+		for i, award := range awards {
+			name, err := award.chooseCreative(tx, roomName, now)
+			if err != nil {
+				return err
+			}
+			record.Awards[i].Creative = name
+			creative, err := getCreative(tx, award.UserID, name)
+			if err != nil {
+				return err
+			}
+			selection := Selection{
+				AuctionID: record.ID,
+				Creative:  creative,
+				Spend:     award.Spend,
+				Cost:      award.Cost,
+				Matches:   award.Matches,
+			}
+			if award.Billing == EngagementBilling {
+				selection.EngagementPrice = Cents(float64(award.Cost) / award.EngagementRate)
+				if selection.EngagementPrice > award.MaxBid {
+					selection.EngagementPrice = award.MaxBid
+				}
+				selection.EngagementRate = award.EngagementRate
+				selection.Cost = 0
+			}
+			txID, err := bill(tx, roomName, selection, impressions)
+			if err == ErrCreditLimit {
+				record.skipBid(award.UserID, award.CreativeName, err.Error())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			record.Awards[i].TxID = txID
+			billed = append(billed, record.Awards[i])
+			selections = append(selections, selection)
+		}
+		record.Awards = billed
+		return record.save(tx)
 	})
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	if creative != nil {
-		fmt.Printf("selecting %s at %s\n", creative.Name, cost)
+	if db.OnSelect != nil {
+		db.OnSelect(roomName, words, minBid, selections)
 	}
-	return creative, cost, nil
+	return selections, nil
 }
 
-func Bill(db *DB, roomName string, userID proto.UserID, cost Cents, creativeName string, impressions int) error {
-	memo := fmt.Sprintf("display %s in &%s at CPI of %s", creativeName, roomName, cost/Cents(impressions))
-	if _, _, err := Transfer(db, cost, userID, System, memo, true); err != nil {
-		return err
+func getCreative(tx *Tx, userID proto.UserID, name string) (*Creative, error) {
+	b := tx.AdvertiserBucket().Bucket([]byte(userID))
+	if b == nil {
+		return &MissingCreative, nil
+	}
+	b = b.Bucket([]byte("creatives"))
+	if b == nil {
+		return &MissingCreative, nil
 	}
-	return SaveMetrics(db, userID, Metrics{
+	encoded := b.Get([]byte(name))
+	if encoded == nil {
+		return &MissingCreative, nil
+	}
+	creative := new(Creative)
+	if err := json.Unmarshal(encoded, creative); err != nil {
+		return nil, err
+	}
+	return creative, nil
+}
+
+func bill(tx *Tx, roomName string, selection Selection, impressions int) (txID snowflake.Snowflake, err error) {
+	creative := selection.Creative
+	cost := selection.Cost
+	memo := fmt.Sprintf("display %s in &%s at CPI of %s", creative.Name, roomName, cost/Cents(impressions))
+	m := Metrics{
 		AdsDisplayed: 1,
 		Impressions:  uint64(impressions),
 		AmountSpent:  uint64(cost),
-	})
+	}
+	now := tx.db.Clock()
+	if selection.EngagementPrice == 0 {
+		if txID, err = charge(tx, cost, creative.UserID, memo); err != nil {
+			return
+		}
+		c := &ChargeRecord{
+			TxID:     txID,
+			Time:     now,
+			UserID:   creative.UserID,
+			Spend:    selection.Spend.CreativeName,
+			Creative: creative.Name,
+			Room:     roomName,
+			Keywords: selection.Matches.Slice(),
+			Metrics:  m,
+		}
+		if err = c.save(tx); err != nil {
+			return
+		}
+	}
+	if err = recordDelivery(tx, roomName, creativeFrequencyKey(creative.UserID, creative.Name), now, MaxFrequencyWindow); err != nil {
+		return
+	}
+	if err = recordDelivery(tx, roomName, roomFrequencyKey, now, time.Hour); err != nil {
+		return
+	}
+	key := SeriesKey{Hour: now, UserID: creative.UserID, Room: roomName, Creative: creative.Name}
+	if err = recordSeries(tx, key, selection.Matches.Slice(), m); err != nil {
+		return
+	}
+	if err = recordBudgetUsage(tx, selection.Spend.UserID, selection.Spend.CreativeName, cost, now); err != nil {
+		return
+	}
+	if err = saveMetrics(tx, creative.UserID, m, (*Metrics).Incr); err != nil {
+		return
+	}
+	if creative.Name != "" {
+		err = saveCreativeMetrics(tx, creative.UserID, creative.Name, m, (*Metrics).Incr)
+	}
+	return
 }
 
 func ResetCampaigns(db *DB) error {
@@ -299,12 +513,15 @@ func ResetCampaigns(db *DB) error {
 				return err
 			}
 		}
-		if err := tx.DeleteBucket([]byte("spend")); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucket([]byte("spend")); err != nil {
-			return err
+		for _, bucket := range []string{"spend", "budget"} {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(bucket)); err != nil {
+				return err
+			}
 		}
+		tx.OnCommit(tx.db.index.Reset)
 		return nil
 	})
 }
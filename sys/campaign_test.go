@@ -0,0 +1,21 @@
+package sys
+
+import "testing"
+
+func TestSelectionExpectedCost(t *testing.T) {
+	cases := []struct {
+		name      string
+		selection Selection
+		expected  Cents
+	}{
+		{"impression", Selection{Cost: 25}, 25},
+		{"engagement", Selection{EngagementPrice: 100, EngagementRate: 0.25}, 25},
+		{"default cap", Selection{EngagementPrice: 100, EngagementRate: 5}, 300},
+		{"spend cap", Selection{Spend: Spend{EngagementCap: 1}, EngagementPrice: 100, EngagementRate: 5}, 100},
+	}
+	for _, tc := range cases {
+		if cost := tc.selection.ExpectedCost(); cost != tc.expected {
+			t.Errorf("%s: expected cost %s, got %s", tc.name, tc.expected, cost)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package sys
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+var ErrCreditLimit = fmt.Errorf("credit limit reached")
+
+func getCreditLimit(tx *Tx, userID proto.UserID) (Cents, error) {
+	b := tx.AdvertiserBucket().Bucket([]byte(userID))
+	if b == nil {
+		return 0, nil
+	}
+	bs := b.Get([]byte("creditlimit"))
+	if bs == nil {
+		return 0, nil
+	}
+	c, err := strconv.ParseInt(string(bs), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return Cents(c), nil
+}
+
+func SetCreditLimit(db *DB, userID proto.UserID, limit Cents) error {
+	if limit < 0 {
+		return fmt.Errorf("credit limit can't be negative")
+	}
+	return db.Update(func(tx *Tx) error {
+		b, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
+		if err != nil {
+			return err
+		}
+		if limit == 0 {
+			err = b.Delete([]byte("creditlimit"))
+		} else {
+			err = b.Put([]byte("creditlimit"), []byte(fmt.Sprintf("%d", limit)))
+		}
+		if err != nil {
+			return err
+		}
+		balance, err := getBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := resumeForCredit(tx, userID, balance); err != nil {
+			return err
+		}
+		return pauseForCredit(tx, userID, balance, limit)
+	})
+}
+
+func creditExempt(userID proto.UserID) bool {
+	return userID == House || userID == System
+}
+
+func availableFunds(tx *Tx, userID proto.UserID) (Cents, error) {
+	balance, err := unexpiredBalance(tx, userID, tx.db.Clock())
+	if err != nil {
+		return 0, err
+	}
+	limit, err := getCreditLimit(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return balance + limit, nil
+}
+
+func charge(tx *Tx, cents Cents, userID proto.UserID, memo string) (txID snowflake.Snowflake, err error) {
+	if creditExempt(userID) {
+		_, _, txID, err = transfer(tx, cents, userID, System, memo, true)
+		return
+	}
+
+	if _, err = expirePromo(tx, userID, tx.db.Clock()); err != nil {
+		return
+	}
+	limit, err := getCreditLimit(tx, userID)
+	if err != nil {
+		return
+	}
+	balance, err := getBalance(tx, userID)
+	if err != nil {
+		return
+	}
+	if cents > balance+limit {
+		err = ErrCreditLimit
+		return
+	}
+	balance, _, txID, err = transfer(tx, cents, userID, System, memo, true)
+	if err != nil {
+		return
+	}
+	if err = consumePromo(tx, userID, txID, cents); err != nil {
+		return
+	}
+	err = pauseForCredit(tx, userID, balance, limit)
+	return
+}
+
+func creditPaused(tx *Tx, userID proto.UserID) bool {
+	b := tx.AdvertiserBucket().Bucket([]byte(userID))
+	return b != nil && b.Get([]byte("paused")) != nil
+}
+
+func pauseForCredit(tx *Tx, userID proto.UserID, balance, limit Cents) error {
+	if balance+limit > 0 || creditPaused(tx, userID) {
+		return nil
+	}
+	b, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+	if err := b.Put([]byte("paused"), []byte(tx.db.Clock().UTC().Format(time.RFC3339))); err != nil {
+		return err
+	}
+	if tx.db.OnPause != nil {
+		tx.OnCommit(func() { tx.db.OnPause(userID, true, balance, limit) })
+	}
+	return nil
+}
+
+func resumeForCredit(tx *Tx, userID proto.UserID, balance Cents) error {
+	if !creditPaused(tx, userID) {
+		return nil
+	}
+	limit, err := getCreditLimit(tx, userID)
+	if err != nil {
+		return err
+	}
+	if balance+limit <= 0 {
+		return nil
+	}
+	if err := tx.AdvertiserBucket().Bucket([]byte(userID)).Delete([]byte("paused")); err != nil {
+		return err
+	}
+	if tx.db.OnPause != nil {
+		tx.OnCommit(func() { tx.db.OnPause(userID, false, balance, limit) })
+	}
+	return nil
+}
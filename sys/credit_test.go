@@ -0,0 +1,85 @@
+package sys
+
+import (
+	"testing"
+
+	"euphoria.io/heim/proto"
+)
+
+func TestCreditLimit(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	var notified []bool
+	db.OnPause = func(userID proto.UserID, paused bool, balance, limit Cents) { notified = append(notified, paused) }
+
+	spend := func(cents Cents) func() error {
+		return func() error {
+			return db.Update(func(tx *Tx) error {
+				_, err := charge(tx, cents, "account:a", "")
+				return err
+			})
+		}
+	}
+	deposit := func(cents Cents) func() error {
+		return func() error {
+			_, _, err := Transfer(db, cents, House, "account:a", "", true)
+			return err
+		}
+	}
+	limit := func(cents Cents) func() error {
+		return func() error { return SetCreditLimit(db, "account:a", cents) }
+	}
+
+	cases := []struct {
+		name    string
+		op      func() error
+		err     error
+		balance Cents
+		paused  bool
+	}{
+		{"deposit", deposit(50), nil, 50, false},
+		{"limit", limit(100), nil, 50, false},
+		{"within balance", spend(30), nil, 20, false},
+		{"into credit", spend(60), nil, -40, false},
+		{"over limit", spend(61), ErrCreditLimit, -40, false},
+		{"up to limit", spend(60), nil, -100, true},
+		{"while paused", spend(1), ErrCreditLimit, -100, true},
+		{"partial deposit", deposit(10), nil, -90, false},
+		{"limit below debt", limit(50), nil, -90, true},
+		{"limit at debt", limit(90), nil, -90, true},
+		{"limit above debt", limit(200), nil, -90, false},
+		{"limit removed", limit(0), nil, -90, true},
+	}
+	for _, tc := range cases {
+		if err := tc.op(); err != tc.err {
+			t.Fatalf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		adv, err := GetAdvertiser(db, "account:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adv.Balance != tc.balance || adv.Paused != tc.paused {
+			t.Errorf("%s: balance %s paused %v, expected %s paused %v", tc.name, adv.Balance, adv.Paused, tc.balance, tc.paused)
+		}
+	}
+
+	expected := []bool{true, false, true, false, true}
+	if len(notified) != len(expected) {
+		t.Fatalf("expected notifications %v, got %v", expected, notified)
+	}
+	for i := range expected {
+		if notified[i] != expected[i] {
+			t.Fatalf("expected notifications %v, got %v", expected, notified)
+		}
+	}
+}
+
+func TestCreditLimitRejectsNegative(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if err := SetCreditLimit(db, "account:a", -1); err == nil {
+		t.Fatal("expected negative credit limit to be rejected")
+	}
+}
@@ -3,8 +3,11 @@ package sys
 import (
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
+
+	"euphoria.io/heim/proto"
 )
 
 type DBFunc func(*Tx) error
@@ -36,38 +39,89 @@ func Open(path string) (*DB, error) {
 		return nil, err
 	}
 
-	sys := &DB{db}
+	sys := &DB{
+		DB:         db,
+		Auctioneer: SecondPrice{},
+		Clock:      time.Now,
+	}
 	err = sys.Update(func(tx *Tx) error {
 		for _, bucket := range buckets() {
 			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
 				return err
 			}
 		}
-		return nil
+		var err error
+		sys.index, err = loadSpendIndex(tx)
+		return err
 	})
 	return sys, err
 }
 
+func OpenReadOnly(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: db, Auctioneer: SecondPrice{}, Clock: time.Now}, nil
+}
+
 type DB struct {
 	*bolt.DB
+	Auctioneer  Auctioneer
+	Clock       func() time.Time
+	CreativeCap FrequencyCap
+	RoomCap     int
+	OnTx        func(writable bool, elapsed time.Duration)
+	OnPause     func(userID proto.UserID, paused bool, balance, limit Cents)
+	OnSelect    func(roomName string, words []string, minBid Cents, selections []Selection)
+
+	index *spendIndex
+}
+
+func Snapshot(path, snapshotPath string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error { return tx.CopyFile(snapshotPath, 0600) })
 }
 
 func (db *DB) Update(f DBFunc) error {
-	return db.DB.Update(func(tx *bolt.Tx) error { return f(&Tx{tx}) })
+	defer db.timeTx(true, time.Now())
+	return db.DB.Update(func(tx *bolt.Tx) error { return f(&Tx{tx, db}) })
 }
 
 func (db *DB) View(f DBFunc) error {
-	return db.DB.View(func(tx *bolt.Tx) error { return f(&Tx{tx}) })
+	defer db.timeTx(false, time.Now())
+	return db.DB.View(func(tx *bolt.Tx) error { return f(&Tx{tx, db}) })
+}
+
+func (db *DB) timeTx(writable bool, started time.Time) {
+	if db.OnTx != nil {
+		db.OnTx(writable, time.Since(started))
+	}
 }
 
 type Tx struct {
 	*bolt.Tx
+	db *DB
 }
 
-func (tx *Tx) AccountBucket() *bolt.Bucket    { return tx.Bucket([]byte("account")) }
-func (tx *Tx) AdvertiserBucket() *bolt.Bucket { return tx.Bucket([]byte("advertiser")) }
-func (tx *Tx) MetricsBucket() *bolt.Bucket    { return tx.Bucket([]byte("metrics")) }
-func (tx *Tx) OverrideBucket() *bolt.Bucket   { return tx.Bucket([]byte("override")) }
-func (tx *Tx) RoomBucket() *bolt.Bucket       { return tx.Bucket([]byte("room")) }
-func (tx *Tx) SpendBucket() *bolt.Bucket      { return tx.Bucket([]byte("spend")) }
-func (tx *Tx) StimulusBucket() *bolt.Bucket   { return tx.Bucket([]byte("stimulus")) }
+func (tx *Tx) AccountBucket() *bolt.Bucket         { return tx.Bucket([]byte("account")) }
+func (tx *Tx) AdvertiserBucket() *bolt.Bucket      { return tx.Bucket([]byte("advertiser")) }
+func (tx *Tx) AuctionBucket() *bolt.Bucket         { return tx.Bucket([]byte("auction")) }
+func (tx *Tx) BudgetBucket() *bolt.Bucket          { return tx.Bucket([]byte("budget")) }
+func (tx *Tx) ChargeBucket() *bolt.Bucket          { return tx.Bucket([]byte("charge")) }
+func (tx *Tx) CreativeMetricsBucket() *bolt.Bucket { return tx.Bucket([]byte("creativemetrics")) }
+func (tx *Tx) FrequencyBucket() *bolt.Bucket       { return tx.Bucket([]byte("frequency")) }
+func (tx *Tx) MetricsBucket() *bolt.Bucket         { return tx.Bucket([]byte("metrics")) }
+func (tx *Tx) OverrideBucket() *bolt.Bucket        { return tx.Bucket([]byte("override")) }
+func (tx *Tx) RefundBucket() *bolt.Bucket          { return tx.Bucket([]byte("refund")) }
+func (tx *Tx) RoomBucket() *bolt.Bucket            { return tx.Bucket([]byte("room")) }
+func (tx *Tx) SeriesBucket() *bolt.Bucket          { return tx.Bucket([]byte("series")) }
+func (tx *Tx) SpendBucket() *bolt.Bucket           { return tx.Bucket([]byte("spend")) }
+func (tx *Tx) SponsoredBucket() *bolt.Bucket       { return tx.Bucket([]byte("sponsored")) }
+func (tx *Tx) StimulusBucket() *bolt.Bucket        { return tx.Bucket([]byte("stimulus")) }
+func (tx *Tx) TokenBucket() *bolt.Bucket           { return tx.Bucket([]byte("token")) }
+func (tx *Tx) ThreadBucket() *bolt.Bucket          { return tx.Bucket([]byte("thread")) }
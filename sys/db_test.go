@@ -0,0 +1,35 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempDBPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "adbot-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "adbot.db")
+}
+
+func openTestDB(t *testing.T, path string) *DB {
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func removeTestDB(path string) { os.RemoveAll(filepath.Dir(path)) }
+
+func newTestDB(t *testing.T) (*DB, func()) {
+	path := tempDBPath(t)
+	db := openTestDB(t, path)
+	return db, func() {
+		db.Close()
+		removeTestDB(path)
+	}
+}
@@ -0,0 +1,189 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+const (
+	ImpressionBilling = "impression"
+	EngagementBilling = "engagement"
+
+	DefaultEngagementCap = 3
+
+	engagementPriorRate   = 0.05
+	engagementPriorWeight = 20
+)
+
+func (s *Spend) engagementCap() int {
+	if s.EngagementCap > 0 {
+		return s.EngagementCap
+	}
+	return DefaultEngagementCap
+}
+
+func (s *Spend) engagementRate(tx *Tx) (float64, error) {
+	names := []string{s.CreativeName}
+	if len(s.Creatives) > 0 {
+		names = names[:0]
+		for _, wc := range s.Creatives {
+			names = append(names, wc.Name)
+		}
+	}
+	var total Metrics
+	for _, name := range names {
+		m, err := loadCreativeMetrics(tx, s.UserID, name)
+		if err != nil {
+			return 0, err
+		}
+		total.Incr(m)
+	}
+	engagements := float64(total.Engagements) + engagementPriorRate*engagementPriorWeight
+	return engagements / (float64(total.AdsDisplayed) + engagementPriorWeight), nil
+}
+
+type Sponsored struct {
+	MessageID snowflake.Snowflake
+	AuctionID snowflake.Snowflake
+	UserID    proto.UserID
+	SpendName string
+	Creative  string
+	Room      string
+	Keywords  []string `json:",omitempty"`
+	Time      time.Time
+	Replies   int
+	Reactions int
+
+	EngagementPrice Cents `json:",omitempty"`
+	EngagementCap   int   `json:",omitempty"`
+	Billed          int   `json:",omitempty"`
+}
+
+func (s *Sponsored) Engagements() int { return s.Replies + s.Reactions }
+
+func (s *Sponsored) save(tx *Tx) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return tx.SponsoredBucket().Put([]byte(s.MessageID.String()), encoded)
+}
+
+func loadSponsored(tx *Tx, messageID string) (*Sponsored, error) {
+	encoded := tx.SponsoredBucket().Get([]byte(messageID))
+	if encoded == nil {
+		return nil, nil
+	}
+	s := &Sponsored{}
+	if err := json.Unmarshal(encoded, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func RecordSponsored(db *DB, messageID snowflake.Snowflake, roomName string, selection Selection) error {
+	s := &Sponsored{
+		MessageID: messageID,
+		AuctionID: selection.AuctionID,
+		UserID:    selection.Spend.UserID,
+		SpendName: selection.Spend.CreativeName,
+		Creative:  selection.Creative.Name,
+		Room:      roomName,
+		Keywords:  selection.Matches.Slice(),
+		Time:      db.Clock(),
+	}
+	if selection.EngagementPrice > 0 {
+		s.EngagementPrice = selection.EngagementPrice
+		s.EngagementCap = selection.Spend.engagementCap()
+	}
+	return db.Update(s.save)
+}
+
+func GetSponsored(db *DB, messageID string) (s *Sponsored, err error) {
+	err = db.View(func(tx *Tx) error {
+		s, err = loadSponsored(tx, messageID)
+		return err
+	})
+	return
+}
+
+func (s *Sponsored) bill(tx *Tx, m *Metrics) error {
+	memo := fmt.Sprintf("engagement with %s in &%s at CPE of %s", s.Creative, s.Room, s.EngagementPrice)
+	txID, err := charge(tx, s.EngagementPrice, s.UserID, memo)
+	if err != nil {
+		return err
+	}
+	now := tx.db.Clock()
+	if err := recordBudgetUsage(tx, s.UserID, s.SpendName, s.EngagementPrice, now); err != nil {
+		return err
+	}
+	s.Billed++
+	m.AmountSpent = uint64(s.EngagementPrice)
+	c := &ChargeRecord{
+		TxID:     txID,
+		Time:     now,
+		UserID:   s.UserID,
+		Spend:    s.SpendName,
+		Creative: s.Creative,
+		Room:     s.Room,
+		Keywords: s.Keywords,
+		Metrics:  Metrics{AmountSpent: m.AmountSpent},
+	}
+	return c.save(tx)
+}
+
+func RecordEngagement(db *DB, parentID, messageID snowflake.Snowflake, senderID proto.UserID, content string) (*Sponsored, error) {
+	var sponsored *Sponsored
+	m := Metrics{Engagements: 1}
+	err := db.Update(func(tx *Tx) error {
+		rootID := parentID.String()
+		if root := tx.ThreadBucket().Get([]byte(rootID)); root != nil {
+			rootID = string(root)
+		}
+		s, err := loadSponsored(tx, rootID)
+		if err != nil || s == nil {
+			return err
+		}
+		if err := tx.ThreadBucket().Put([]byte(messageID.String()), []byte(rootID)); err != nil {
+			return err
+		}
+		if senderID == s.UserID {
+			return nil
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(content), "!") {
+			s.Reactions++
+		} else {
+			s.Replies++
+			if s.EngagementPrice > 0 && s.Billed < s.EngagementCap {
+				if err := s.bill(tx, &m); err != nil && err != ErrCreditLimit {
+					return err
+				}
+			}
+		}
+		if err := s.save(tx); err != nil {
+			return err
+		}
+		key := SeriesKey{Hour: tx.db.Clock(), UserID: s.UserID, Room: s.Room, Creative: s.Creative}
+		if err := recordSeries(tx, key, s.Keywords, m); err != nil {
+			return err
+		}
+		if err := saveMetrics(tx, s.UserID, m, (*Metrics).Incr); err != nil {
+			return err
+		}
+		if err := saveCreativeMetrics(tx, s.UserID, s.Creative, m, (*Metrics).Incr); err != nil {
+			return err
+		}
+		sponsored = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sponsored, nil
+}
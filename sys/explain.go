@@ -0,0 +1,70 @@
+package sys
+
+import "fmt"
+
+type Explanation struct {
+	Bid
+	Outcome string
+}
+
+func Explain(db *DB, roomName, content string, minBid Cents) ([]Explanation, error) {
+	explanations := []Explanation{}
+	words := ParseWordSeq(content)
+
+	err := db.View(func(tx *Tx) error {
+		now := db.Clock()
+		remaining, capped, err := roomAdsRemaining(tx, roomName, db.RoomCap, now)
+		if err != nil {
+			return err
+		}
+
+		bids, err := getBids(tx, tx.db.index.All(), roomName, words, minBid, now, func(bid Bid, reason string) {
+			explanations = append(explanations, Explanation{Bid: bid, Outcome: "dropped: " + reason})
+		})
+		if err != nil {
+			return err
+		}
+
+		candidates := make(BidList, len(bids))
+		copy(candidates, bids)
+		awards := db.Auctioneer.Auction(candidates)
+
+		won := map[string]bool{}
+		results := make([]Explanation, 0, len(bids))
+		for i, award := range awards {
+			won[fmt.Sprintf("%s:%s", award.UserID, award.CreativeName)] = true
+			if capped && i >= remaining {
+				results = append(results, Explanation{
+					Bid:     award.Bid,
+					Outcome: fmt.Sprintf("skipped: room cap of %d ads per hour reached", db.RoomCap),
+				})
+				continue
+			}
+			if award.Billing != EngagementBilling && !creditExempt(award.UserID) {
+				funds, err := availableFunds(tx, award.UserID)
+				if err != nil {
+					return err
+				}
+				if award.Cost > funds {
+					results = append(results, Explanation{Bid: award.Bid, Outcome: "skipped: " + ErrCreditLimit.Error()})
+					continue
+				}
+			}
+			results = append(results, Explanation{
+				Bid:     award.Bid,
+				Outcome: fmt.Sprintf("won slot %d, clearing price %s", i+1, award.Cost),
+			})
+		}
+		for _, bid := range candidates {
+			if !won[fmt.Sprintf("%s:%s", bid.UserID, bid.CreativeName)] {
+				results = append(results, Explanation{Bid: bid, Outcome: "outbid"})
+			}
+		}
+		explanations = append(results, explanations...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return explanations, nil
+}
@@ -0,0 +1,58 @@
+package sys
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainGatesLikeSelect(t *testing.T) {
+	cases := []struct {
+		name    string
+		setup   func(db *DB, now *time.Time)
+		outcome string
+	}{
+		{"funded", func(db *DB, now *time.Time) {
+			Transfer(db, 500, House, "account:a", "", true)
+		}, "won slot 1"},
+		{"room cap", func(db *DB, now *time.Time) {
+			Transfer(db, 500, House, "account:a", "", true)
+			db.RoomCap = 1
+			if _, err := Select(db, "music", "music", 10, 5); err != nil {
+				t.Fatal(err)
+			}
+		}, "skipped: room cap of 1 ads per hour reached"},
+		{"expired promo", func(db *DB, now *time.Time) {
+			db.Update(func(tx *Tx) error { return grantPromo(tx, 500, "account:a", "", time.Hour) })
+			*now = now.Add(2 * time.Hour)
+		}, "dropped: available funds"},
+		{"credit pause", func(db *DB, now *time.Time) {
+			SetCreditLimit(db, "account:a", 100)
+			db.Update(func(tx *Tx) error {
+				_, err := charge(tx, 100, "account:a", "")
+				return err
+			})
+		}, "dropped: advertiser paused at credit limit"},
+	}
+	for _, tc := range cases {
+		path := tempDBPath(t)
+		db := openTestDB(t, path)
+
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		db.Clock = func() time.Time { return now }
+		NewCreative(db, "account:a", "foo", "buy foo")
+		NewSpend(db, &Spend{UserID: "account:a", CreativeName: "foo", MaxBid: 100, Keywords: ParseWordList("music")})
+		tc.setup(db, &now)
+
+		explanations, err := Explain(db, "music", "music", 10)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if len(explanations) != 1 || !strings.HasPrefix(explanations[0].Outcome, tc.outcome) {
+			t.Errorf("%s: expected outcome %q, got %+v", tc.name, tc.outcome, explanations)
+		}
+
+		db.Close()
+		removeTestDB(path)
+	}
+}
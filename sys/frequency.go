@@ -0,0 +1,131 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"euphoria.io/heim/proto"
+)
+
+const (
+	MaxFrequencyWindow = 7 * 24 * time.Hour
+
+	roomFrequencyKey = "*"
+)
+
+type FrequencyCap struct {
+	Count  int
+	Window time.Duration
+}
+
+func (fc FrequencyCap) String() string {
+	window := fc.Window.String()
+	if strings.HasSuffix(window, "m0s") {
+		window = window[:len(window)-2]
+	}
+	if strings.HasSuffix(window, "h0m") {
+		window = window[:len(window)-2]
+	}
+	return fmt.Sprintf("%d/%s", fc.Count, window)
+}
+
+func (s *Spend) frequencyCap(defaultCap FrequencyCap) FrequencyCap {
+	if s.FrequencyCap != nil {
+		return *s.FrequencyCap
+	}
+	return defaultCap
+}
+
+func creativeFrequencyKey(userID proto.UserID, creativeName string) string {
+	return fmt.Sprintf("%s:%s", userID, creativeName)
+}
+
+func (s *Spend) uncappedCreatives(tx *Tx, roomName string, now time.Time) ([]WeightedCreative, error) {
+	creatives := s.Creatives
+	if len(creatives) == 0 {
+		creatives = []WeightedCreative{{Name: s.CreativeName, Weight: 1}}
+	}
+	fc := s.frequencyCap(tx.db.CreativeCap)
+	if fc.Count <= 0 {
+		return creatives, nil
+	}
+	available := []WeightedCreative{}
+	for _, wc := range creatives {
+		n, err := deliveriesSince(tx, roomName, creativeFrequencyKey(s.UserID, wc.Name), now.Add(-fc.Window))
+		if err != nil {
+			return nil, err
+		}
+		if n < fc.Count {
+			available = append(available, wc)
+		}
+	}
+	return available, nil
+}
+
+func loadDeliveries(tx *Tx, roomName, key string) ([]time.Time, error) {
+	b := tx.FrequencyBucket().Bucket([]byte(roomName))
+	if b == nil {
+		return nil, nil
+	}
+	encoded := b.Get([]byte(key))
+	if encoded == nil {
+		return nil, nil
+	}
+	deliveries := []time.Time{}
+	if err := json.Unmarshal(encoded, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func deliveriesSince(tx *Tx, roomName, key string, since time.Time) (int, error) {
+	deliveries, err := loadDeliveries(tx, roomName, key)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range deliveries {
+		if t.After(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func recordDelivery(tx *Tx, roomName, key string, now time.Time, retention time.Duration) error {
+	deliveries, err := loadDeliveries(tx, roomName, key)
+	if err != nil {
+		return err
+	}
+	kept := []time.Time{now}
+	for _, t := range deliveries {
+		if t.After(now.Add(-retention)) {
+			kept = append(kept, t)
+		}
+	}
+	encoded, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	b, err := tx.FrequencyBucket().CreateBucketIfNotExists([]byte(roomName))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), encoded)
+}
+
+func roomAdsRemaining(tx *Tx, roomName string, roomCap int, now time.Time) (remaining int, capped bool, err error) {
+	if roomCap <= 0 {
+		return 0, false, nil
+	}
+	n, err := deliveriesSince(tx, roomName, roomFrequencyKey, now.Add(-time.Hour))
+	if err != nil {
+		return 0, true, err
+	}
+	if n >= roomCap {
+		return 0, true, nil
+	}
+	return roomCap - n, true, nil
+}
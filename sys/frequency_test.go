@@ -0,0 +1,64 @@
+package sys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrequencyCapPerCreative(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	hourly := &FrequencyCap{Count: 1, Window: time.Hour}
+	rotating := Spend{UserID: "account:a", CreativeName: "spring", FrequencyCap: hourly,
+		Creatives: []WeightedCreative{{Name: "foo", Weight: 1}, {Name: "bar", Weight: 1}}}
+	shared := Spend{UserID: "account:a", CreativeName: "foo", FrequencyCap: hourly}
+	daily := Spend{UserID: "account:a", CreativeName: "foo", FrequencyCap: &FrequencyCap{Count: 2, Window: 24 * time.Hour}}
+
+	deliver := func(at time.Duration) {
+		err := db.Update(func(tx *Tx) error {
+			return recordDelivery(tx, "music", creativeFrequencyKey("account:a", "foo"), start.Add(at), MaxFrequencyWindow)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		deliver   bool
+		at        time.Duration
+		spend     Spend
+		available []string
+	}{
+		{"uncapped", false, 0, rotating, []string{"foo", "bar"}},
+		{"rotation skips capped creative", true, 0, rotating, []string{"bar"}},
+		{"shared creative capped", false, time.Minute, shared, nil},
+		{"window passed", false, 2 * time.Hour, rotating, []string{"foo", "bar"}},
+		{"longer window", true, 2 * time.Hour, daily, nil},
+		{"longer window passed", false, 25 * time.Hour, daily, []string{"foo"}},
+	}
+	for _, tc := range cases {
+		if tc.deliver {
+			deliver(tc.at)
+		}
+		var available []WeightedCreative
+		err := db.View(func(tx *Tx) error {
+			var err error
+			available, err = tc.spend.uncappedCreatives(tx, "music", start.Add(tc.at+time.Minute))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(available) != len(tc.available) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.available, available)
+		}
+		for i, wc := range available {
+			if wc.Name != tc.available[i] {
+				t.Errorf("%s: expected %v, got %v", tc.name, tc.available, available)
+			}
+		}
+	}
+}
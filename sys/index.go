@@ -0,0 +1,180 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"euphoria.io/heim/proto"
+)
+
+type spendIndex struct {
+	sync.RWMutex
+	spends         map[string]Spend
+	words          map[string]map[string]struct{}
+	userOverrides  map[proto.UserID]bool
+	spendOverrides map[proto.UserID]map[string]bool
+}
+
+func loadSpendIndex(tx *Tx) (*spendIndex, error) {
+	idx := &spendIndex{
+		spends: map[string]Spend{},
+		words:  map[string]map[string]struct{}{},
+	}
+
+	err := tx.SpendBucket().ForEach(func(k, v []byte) error {
+		spend := Spend{}
+		if err := json.Unmarshal(v, &spend); err != nil {
+			return err
+		}
+		idx.put(spend)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.userOverrides, err = userOverrides(tx); err != nil {
+		return nil, err
+	}
+	if idx.userOverrides == nil {
+		idx.userOverrides = map[proto.UserID]bool{}
+	}
+	if idx.spendOverrides, err = spendOverrides(tx); err != nil {
+		return nil, err
+	}
+	if idx.spendOverrides == nil {
+		idx.spendOverrides = map[proto.UserID]map[string]bool{}
+	}
+	return idx, nil
+}
+
+func (s *Spend) indexWords() []string {
+	words := make([]string, 0, len(s.Keywords)+len(s.Phrases))
+	for w, _ := range s.Keywords {
+		words = append(words, w)
+	}
+	for _, phrase := range s.Phrases {
+		words = append(words, phrase.Words[0])
+	}
+	return words
+}
+
+func (idx *spendIndex) put(spend Spend) {
+	globalKey := fmt.Sprintf("%s:%s", spend.UserID, spend.CreativeName)
+	if _, ok := idx.spends[globalKey]; ok {
+		idx.remove(spend.UserID, spend.CreativeName)
+	}
+	idx.spends[globalKey] = spend
+	for _, w := range spend.indexWords() {
+		keys, ok := idx.words[w]
+		if !ok {
+			keys = map[string]struct{}{}
+			idx.words[w] = keys
+		}
+		keys[globalKey] = struct{}{}
+	}
+}
+
+func (idx *spendIndex) remove(userID proto.UserID, creativeName string) {
+	globalKey := fmt.Sprintf("%s:%s", userID, creativeName)
+	spend, ok := idx.spends[globalKey]
+	if !ok {
+		return
+	}
+	for _, w := range spend.indexWords() {
+		delete(idx.words[w], globalKey)
+		if len(idx.words[w]) == 0 {
+			delete(idx.words, w)
+		}
+	}
+	delete(idx.spends, globalKey)
+}
+
+func (idx *spendIndex) Put(spends ...Spend) {
+	idx.Lock()
+	defer idx.Unlock()
+	for _, spend := range spends {
+		idx.put(spend)
+	}
+}
+
+func (idx *spendIndex) Remove(userID proto.UserID, creativeName string) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.remove(userID, creativeName)
+}
+
+func (idx *spendIndex) Reset() {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.spends = map[string]Spend{}
+	idx.words = map[string]map[string]struct{}{}
+}
+
+func (idx *spendIndex) SetUserEnabled(userID proto.UserID, enabled bool) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.userOverrides[userID] = enabled
+}
+
+func (idx *spendIndex) SetSpendEnabled(userID proto.UserID, creativeName string, enabled bool) {
+	idx.Lock()
+	defer idx.Unlock()
+	m, ok := idx.spendOverrides[userID]
+	if !ok {
+		m = map[string]bool{}
+		idx.spendOverrides[userID] = m
+	}
+	m[creativeName] = enabled
+}
+
+func (idx *spendIndex) Enabled(spend Spend) (ok bool, reason string) {
+	idx.RLock()
+	defer idx.RUnlock()
+	if enabled, ok := idx.spendOverrides[spend.UserID][spend.CreativeName]; ok && !enabled {
+		return false, "spend disabled"
+	}
+	if enabled, ok := idx.userOverrides[spend.UserID]; ok && !enabled {
+		return false, "advertiser disabled"
+	}
+	return true, ""
+}
+
+func (idx *spendIndex) Lookup(words WordSeq) []Spend {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	keys := []string{}
+	seen := map[string]struct{}{}
+	for _, w := range words {
+		for globalKey, _ := range idx.words[w] {
+			if _, ok := seen[globalKey]; !ok {
+				seen[globalKey] = struct{}{}
+				keys = append(keys, globalKey)
+			}
+		}
+	}
+	return idx.collect(keys)
+}
+
+func (idx *spendIndex) All() []Spend {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	keys := make([]string, 0, len(idx.spends))
+	for globalKey, _ := range idx.spends {
+		keys = append(keys, globalKey)
+	}
+	return idx.collect(keys)
+}
+
+func (idx *spendIndex) collect(keys []string) []Spend {
+	sort.Strings(keys)
+	spends := make([]Spend, len(keys))
+	for i, globalKey := range keys {
+		spends[i] = idx.spends[globalKey]
+	}
+	return spends
+}
@@ -1,6 +1,7 @@
 package sys
 
 import (
+	"sort"
 	"strings"
 	"unicode"
 
@@ -9,17 +10,126 @@ import (
 
 type WordList map[string]struct{}
 
+func stem(word string) string {
+	word = strings.ToLower(word)
+	word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) })
+	return porter2.Stem(word)
+}
+
 func ParseWordList(content string) WordList {
 	words := WordList{}
 	for _, word := range strings.Fields(content) {
-		word = strings.ToLower(word)
-		word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) })
-		word = porter2.Stem(word)
-		words[word] = struct{}{}
+		words[stem(word)] = struct{}{}
+	}
+	return words
+}
+
+type WordSeq []string
+
+func ParseWordSeq(content string) WordSeq {
+	words := WordSeq{}
+	for _, word := range strings.Fields(content) {
+		if w := stem(word); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func (ws WordSeq) WordList() WordList {
+	words := WordList{}
+	for _, w := range ws {
+		words[w] = struct{}{}
 	}
 	return words
 }
 
+func (ws WordSeq) Contains(phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(ws); i++ {
+		match := true
+		for j, w := range phrase {
+			if ws[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (ws WordSeq) Equals(phrase []string) bool {
+	return len(ws) == len(phrase) && ws.Contains(phrase)
+}
+
+type Phrase struct {
+	Words []string
+	Exact bool `json:",omitempty"`
+}
+
+func (p Phrase) String() string {
+	if p.Exact {
+		return "[" + strings.Join(p.Words, " ") + "]"
+	}
+	return `"` + strings.Join(p.Words, " ") + `"`
+}
+
+func (p Phrase) Match(words WordSeq) bool {
+	if p.Exact {
+		return words.Equals(p.Words)
+	}
+	return words.Contains(p.Words)
+}
+
+func ParseKeywords(content string) (keywords WordList, phrases []Phrase, negative WordList) {
+	keywords = WordList{}
+	negative = WordList{}
+	for content = strings.TrimSpace(content); content != ""; content = strings.TrimSpace(content) {
+		var closer string
+		switch content[0] {
+		case '"':
+			closer = `"`
+		case '[':
+			closer = "]"
+		}
+		if closer != "" {
+			end := strings.Index(content[1:], closer) + 1
+			rest := end + 1
+			if end == 0 {
+				end, rest = len(content), len(content)
+			}
+			phrase := Phrase{
+				Words: ParseWordSeq(content[1:end]),
+				Exact: closer == "]",
+			}
+			if len(phrase.Words) > 0 {
+				phrases = append(phrases, phrase)
+			}
+			content = content[rest:]
+			continue
+		}
+
+		word := content
+		if end := strings.IndexFunc(content, unicode.IsSpace); end >= 0 {
+			word = content[:end]
+		}
+		content = content[len(word):]
+		if strings.HasPrefix(word, "-") {
+			if w := stem(word); w != "" {
+				negative[w] = struct{}{}
+			}
+			continue
+		}
+		keywords[stem(word)] = struct{}{}
+	}
+	return
+}
+
 func (a WordList) Match(b WordList) WordList {
 	m := WordList{}
 	for w, _ := range a {
@@ -29,3 +139,14 @@ func (a WordList) Match(b WordList) WordList {
 	}
 	return m
 }
+
+func (a WordList) Slice() []string {
+	words := make([]string, 0, len(a))
+	for w, _ := range a {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+func (a WordList) String() string { return strings.Join(a.Slice(), ",") }
@@ -0,0 +1,162 @@
+package sys
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+type LedgerFilter struct {
+	UserID       proto.UserID
+	Since        time.Time
+	Until        time.Time
+	Counterparty proto.UserID
+	Memo         *regexp.Regexp
+}
+
+func (f *LedgerFilter) Match(entry *LedgerEntry) bool {
+	if !f.Since.IsZero() && (entry.Time.IsZero() || entry.Time.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && (entry.Time.IsZero() || !entry.Time.Before(f.Until)) {
+		return false
+	}
+	if f.Counterparty != "" && entry.From != f.Counterparty && entry.To != f.Counterparty {
+		return false
+	}
+	if f.Memo != nil && !f.Memo.MatchString(entry.Memo) {
+		return false
+	}
+	return true
+}
+
+func ledgerBucket(tx *Tx, userID proto.UserID) *bolt.Bucket {
+	ab := tx.AdvertiserBucket()
+	if ab == nil {
+		return nil
+	}
+	b := ab.Bucket([]byte(userID))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte("ledger"))
+}
+
+func MapLedger(db *DB, filter LedgerFilter, f func(userID proto.UserID, entry *LedgerEntry) error) error {
+	return db.View(func(tx *Tx) error {
+		userIDs := []proto.UserID{filter.UserID}
+		if filter.UserID == "" {
+			userIDs = userIDs[:0]
+			ab := tx.AdvertiserBucket()
+			if ab == nil {
+				return nil
+			}
+			err := ab.ForEach(func(k, v []byte) error {
+				if v == nil {
+					userIDs = append(userIDs, proto.UserID(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, userID := range userIDs {
+			b := ledgerBucket(tx, userID)
+			if b == nil {
+				continue
+			}
+			err := b.ForEach(func(k, v []byte) error {
+				entry := &LedgerEntry{}
+				if err := json.Unmarshal(v, entry); err != nil {
+					return err
+				}
+				if !filter.Match(entry) {
+					return nil
+				}
+				return f(userID, entry)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func ledgerKey(t time.Time) []byte {
+	ms := t.UnixNano()/int64(time.Millisecond) - snowflake.Epoch
+	if ms <= 0 {
+		return []byte{}
+	}
+	return []byte(snowflake.Snowflake(uint64(ms) << 22).String())
+}
+
+func QueryLedger(db *DB, filter LedgerFilter, before string, limit int) (entries []LedgerEntry, more bool, err error) {
+	entries = []LedgerEntry{}
+	err = db.View(func(tx *Tx) error {
+		b := ledgerBucket(tx, filter.UserID)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+
+		var end []byte
+		if before != "" {
+			end = []byte(before)
+		}
+		if !filter.Until.IsZero() {
+			if k := ledgerKey(filter.Until); end == nil || bytes.Compare(k, end) < 0 {
+				end = k
+			}
+		}
+		var start []byte
+		if !filter.Since.IsZero() {
+			start = ledgerKey(filter.Since)
+		}
+		match := filter
+		match.Since, match.Until = time.Time{}, time.Time{}
+
+		k, v := c.Last()
+		if end != nil {
+			if k, v = c.Seek(end); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if start != nil && bytes.Compare(k, start) < 0 {
+				break
+			}
+			entry := LedgerEntry{}
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !match.Match(&entry) {
+				continue
+			}
+			if len(entries) == limit {
+				more = true
+				break
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i := 0; i < len(entries)/2; i++ {
+		entries[i], entries[len(entries)-i-1] = entries[len(entries)-i-1], entries[i]
+	}
+	return entries, more, nil
+}
@@ -0,0 +1,91 @@
+package sys
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQueryLedgerSeek(t *testing.T) {
+	path := tempDBPath(t)
+	defer removeTestDB(path)
+	db := openTestDB(t, path)
+	defer db.Close()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := db.Update(func(tx *Tx) error {
+		ab, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte("account:abc"))
+		if err != nil {
+			return err
+		}
+		b, err := ab.CreateBucketIfNotExists([]byte("ledger"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 10; i++ {
+			entry := LedgerEntry{Cents: Cents(i + 1), From: House, To: "account:abc"}
+			if err := entry.TxID.FromString(string(ledgerKey(start.Add(time.Duration(i) * time.Hour)))); err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(entry.TxID.String()), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		filter LedgerFilter
+		limit  int
+		cents  []Cents
+		more   bool
+	}{
+		{"latest", LedgerFilter{}, 3, []Cents{8, 9, 10}, true},
+		{"all", LedgerFilter{}, 10, []Cents{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, false},
+		{"until", LedgerFilter{Until: start.Add(5 * time.Hour)}, 2, []Cents{4, 5}, true},
+		{"until between", LedgerFilter{Until: start.Add(150 * time.Minute)}, 10, []Cents{1, 2, 3}, false},
+		{"until after", LedgerFilter{Until: start.Add(24 * time.Hour)}, 1, []Cents{10}, true},
+		{"until before", LedgerFilter{Until: start.Add(-time.Hour)}, 10, nil, false},
+		{"range", LedgerFilter{Since: start.Add(2 * time.Hour), Until: start.Add(4 * time.Hour)}, 10, []Cents{3, 4}, false},
+	}
+	for _, tc := range cases {
+		tc.filter.UserID = "account:abc"
+		entries, more, err := QueryLedger(db, tc.filter, "", tc.limit)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if len(entries) != len(tc.cents) || more != tc.more {
+			t.Fatalf("%s: got %d entries (more=%v), expected %d (more=%v)", tc.name, len(entries), more, len(tc.cents), tc.more)
+		}
+		for i, entry := range entries {
+			if entry.Cents != tc.cents[i] {
+				t.Errorf("%s: entry %d is %s, expected %s", tc.name, i, entry.Cents, tc.cents[i])
+			}
+		}
+	}
+
+	filter := LedgerFilter{UserID: "account:abc", Until: start.Add(7 * time.Hour)}
+	var pages [][]LedgerEntry
+	for before := ""; ; {
+		entries, more, err := QueryLedger(db, filter, before, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, entries)
+		if !more {
+			break
+		}
+		before = entries[0].TxID.String()
+	}
+	if len(pages) != 3 || len(pages[2]) != 1 || pages[2][0].Cents != 1 || pages[0][2].Cents != 7 {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+}
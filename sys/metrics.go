@@ -13,6 +13,7 @@ type Metrics struct {
 	Impressions        uint64
 	AmountSpent        uint64
 	AmountSpentByHouse uint64
+	Engagements        uint64
 }
 
 func (m *Metrics) Incr(n Metrics) *Metrics {
@@ -20,6 +21,23 @@ func (m *Metrics) Incr(n Metrics) *Metrics {
 	m.Impressions += n.Impressions
 	m.AmountSpent += n.AmountSpent
 	m.AmountSpentByHouse += n.AmountSpentByHouse
+	m.Engagements += n.Engagements
+	return m
+}
+
+func (m *Metrics) Decr(n Metrics) *Metrics {
+	sub := func(x *uint64, y uint64) {
+		if *x < y {
+			*x = 0
+		} else {
+			*x -= y
+		}
+	}
+	sub(&m.AdsDisplayed, n.AdsDisplayed)
+	sub(&m.Impressions, n.Impressions)
+	sub(&m.AmountSpent, n.AmountSpent)
+	sub(&m.AmountSpentByHouse, n.AmountSpentByHouse)
+	sub(&m.Engagements, n.Engagements)
 	return m
 }
 
@@ -40,26 +58,28 @@ func (m *Metrics) Save(b *bolt.Bucket, key []byte) error {
 }
 
 func SaveMetrics(db *DB, userID proto.UserID, m Metrics) error {
+	return db.Update(func(tx *Tx) error { return saveMetrics(tx, userID, m, (*Metrics).Incr) })
+}
+
+func saveMetrics(tx *Tx, userID proto.UserID, m Metrics, apply func(*Metrics, Metrics) *Metrics) error {
 	if userID == House {
 		m.AmountSpentByHouse = m.AmountSpent
 	}
-	return db.Update(func(tx *Tx) error {
-		b := tx.MetricsBucket()
-		if userID != "" {
-			var usrm Metrics
-			if err := usrm.Load(b, []byte(userID)); err != nil {
-				return err
-			}
-			if err := usrm.Incr(m).Save(b, []byte(userID)); err != nil {
-				return err
-			}
+	b := tx.MetricsBucket()
+	if userID != "" {
+		var usrm Metrics
+		if err := usrm.Load(b, []byte(userID)); err != nil {
+			return err
 		}
-		var sysm Metrics
-		if err := sysm.Load(b, []byte("system")); err != nil {
+		if err := apply(&usrm, m).Save(b, []byte(userID)); err != nil {
 			return err
 		}
-		return sysm.Incr(m).Save(b, []byte("system"))
-	})
+	}
+	var sysm Metrics
+	if err := sysm.Load(b, []byte("system")); err != nil {
+		return err
+	}
+	return apply(&sysm, m).Save(b, []byte("system"))
 }
 
 func LoadMetrics(db *DB, userID proto.UserID) (m Metrics, err error) {
@@ -68,3 +88,54 @@ func LoadMetrics(db *DB, userID proto.UserID) (m Metrics, err error) {
 	})
 	return
 }
+
+type CreativeMetrics struct {
+	Name string
+	Metrics
+}
+
+func SaveCreativeMetrics(db *DB, userID proto.UserID, creativeName string, m Metrics) error {
+	return db.Update(func(tx *Tx) error {
+		return saveCreativeMetrics(tx, userID, creativeName, m, (*Metrics).Incr)
+	})
+}
+
+func saveCreativeMetrics(tx *Tx, userID proto.UserID, creativeName string, m Metrics, apply func(*Metrics, Metrics) *Metrics) error {
+	b, err := tx.CreativeMetricsBucket().CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+	var cm Metrics
+	if err := cm.Load(b, []byte(creativeName)); err != nil {
+		return err
+	}
+	return apply(&cm, m).Save(b, []byte(creativeName))
+}
+
+func loadCreativeMetrics(tx *Tx, userID proto.UserID, creativeName string) (m Metrics, err error) {
+	b := tx.CreativeMetricsBucket().Bucket([]byte(userID))
+	if b == nil {
+		return
+	}
+	err = m.Load(b, []byte(creativeName))
+	return
+}
+
+func LoadCreativeMetrics(db *DB, userID proto.UserID) ([]CreativeMetrics, error) {
+	metrics := []CreativeMetrics{}
+	err := db.View(func(tx *Tx) error {
+		b := tx.CreativeMetricsBucket().Bucket([]byte(userID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			cm := CreativeMetrics{Name: string(k)}
+			if err := json.Unmarshal(v, &cm.Metrics); err != nil {
+				return err
+			}
+			metrics = append(metrics, cm)
+			return nil
+		})
+	})
+	return metrics, err
+}
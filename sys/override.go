@@ -8,18 +8,21 @@ import (
 )
 
 func SetUserEnabled(db *DB, userID proto.UserID, enabled bool) error {
-	return db.Update(func(tx *Tx) error {
-		b, err := tx.OverrideBucket().CreateBucketIfNotExists([]byte("user"))
-		if err != nil {
-			return err
-		}
-		v := "0"
-		if enabled {
-			v = "1"
-		}
-		b.Put([]byte(userID), []byte(v))
-		return nil
-	})
+	return db.Update(func(tx *Tx) error { return setUserEnabled(tx, userID, enabled) })
+}
+
+func setUserEnabled(tx *Tx, userID proto.UserID, enabled bool) error {
+	b, err := tx.OverrideBucket().CreateBucketIfNotExists([]byte("user"))
+	if err != nil {
+		return err
+	}
+	v := "0"
+	if enabled {
+		v = "1"
+	}
+	b.Put([]byte(userID), []byte(v))
+	tx.OnCommit(func() { tx.db.index.SetUserEnabled(userID, enabled) })
+	return nil
 }
 
 func userOverrides(tx *Tx) (map[proto.UserID]bool, error) {
@@ -37,36 +40,67 @@ func userOverrides(tx *Tx) (map[proto.UserID]bool, error) {
 
 func SetSpendEnabled(db *DB, userID proto.UserID, creativeName string, enabled bool) error {
 	return db.Update(func(tx *Tx) error {
-		b, err := tx.OverrideBucket().CreateBucketIfNotExists([]byte("spend"))
+		sb, err := tx.OverrideBucket().CreateBucketIfNotExists([]byte("spends"))
+		if err != nil {
+			return err
+		}
+		b, err := sb.CreateBucketIfNotExists([]byte(userID))
 		if err != nil {
 			return err
 		}
-		k := fmt.Sprintf("%s:%s", userID, creativeName)
 		v := "0"
 		if enabled {
 			v = "1"
 		}
-		b.Put([]byte(k), []byte(v))
+		if err := b.Put([]byte(creativeName), []byte(v)); err != nil {
+			return err
+		}
+		if legacy := tx.OverrideBucket().Bucket([]byte("spend")); legacy != nil {
+			if err := legacy.Delete([]byte(fmt.Sprintf("%s:%s", userID, creativeName))); err != nil {
+				return err
+			}
+		}
+		tx.OnCommit(func() { tx.db.index.SetSpendEnabled(userID, creativeName, enabled) })
 		return nil
 	})
 }
 
 func spendOverrides(tx *Tx) (map[proto.UserID]map[string]bool, error) {
-	b := tx.OverrideBucket().Bucket([]byte("spend"))
-	if b == nil {
-		return nil, nil
-	}
 	overrides := map[proto.UserID]map[string]bool{}
-	err := b.ForEach(func(k, v []byte) error {
-		parts := strings.Split(string(k), ":")
-		userID := proto.UserID(parts[0])
+	set := func(userID proto.UserID, creativeName string, v []byte) {
 		m, ok := overrides[userID]
 		if !ok {
 			m = map[string]bool{}
 			overrides[userID] = m
 		}
-		m[parts[1]] = string(v) == "1"
-		return nil
+		m[creativeName] = string(v) == "1"
+	}
+
+	if legacy := tx.OverrideBucket().Bucket([]byte("spend")); legacy != nil {
+		err := legacy.ForEach(func(k, v []byte) error {
+			if idx := strings.LastIndex(string(k), ":"); idx >= 0 {
+				set(proto.UserID(k[:idx]), string(k[idx+1:]), v)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sb := tx.OverrideBucket().Bucket([]byte("spends"))
+	if sb == nil {
+		return overrides, nil
+	}
+	err := sb.ForEach(func(userID, v []byte) error {
+		b := sb.Bucket(userID)
+		if v != nil || b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			set(proto.UserID(userID), string(k), v)
+			return nil
+		})
 	})
 	return overrides, err
 }
@@ -0,0 +1,28 @@
+package sys
+
+import "testing"
+
+func TestSpendOverrideSurvivesReopen(t *testing.T) {
+	path := tempDBPath(t)
+	defer removeTestDB(path)
+
+	spend := Spend{UserID: "account:abc", CreativeName: "spring:sale"}
+	db := openTestDB(t, path)
+	if err := SetSpendEnabled(db, spend.UserID, spend.CreativeName, false); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := db.index.Enabled(spend); ok {
+		t.Fatal("expected spend to be disabled before reopening")
+	}
+	db.Close()
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	if ok, _ := db.index.Enabled(spend); ok {
+		t.Fatal("expected spend to be disabled after reopening")
+	}
+	other := Spend{UserID: "account:abc", CreativeName: "spring"}
+	if ok, _ := db.index.Enabled(other); !ok {
+		t.Fatal("expected other spend to be enabled after reopening")
+	}
+}
@@ -0,0 +1,257 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+type PromoLot struct {
+	TxID      snowflake.Snowflake
+	Cents     Cents
+	Remaining Cents
+	Expires   time.Time
+}
+
+type promoUse struct {
+	Lot     snowflake.Snowflake
+	Cents   Cents
+	Expires time.Time
+	Used    Cents
+}
+
+type lotsByExpiry []PromoLot
+
+func (ls lotsByExpiry) Len() int           { return len(ls) }
+func (ls lotsByExpiry) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
+func (ls lotsByExpiry) Less(i, j int) bool { return ls[i].Expires.Before(ls[j].Expires) }
+
+func promoBucket(tx *Tx, userID proto.UserID) *bolt.Bucket {
+	b := tx.AdvertiserBucket().Bucket([]byte(userID))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte("promo"))
+}
+
+func promoLots(tx *Tx, userID proto.UserID) ([]PromoLot, error) {
+	lots := []PromoLot{}
+	b := promoBucket(tx, userID)
+	if b == nil {
+		return lots, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		lot := PromoLot{}
+		if err := json.Unmarshal(v, &lot); err != nil {
+			return err
+		}
+		lots = append(lots, lot)
+		return nil
+	})
+	sort.Sort(lotsByExpiry(lots))
+	return lots, err
+}
+
+func promoBalance(tx *Tx, userID proto.UserID) (Cents, error) {
+	lots, err := promoLots(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var total Cents
+	for _, lot := range lots {
+		total += lot.Remaining
+	}
+	return total, nil
+}
+
+func expiredPromo(tx *Tx, userID proto.UserID, now time.Time) (Cents, error) {
+	lots, err := promoLots(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var expired Cents
+	for _, lot := range lots {
+		if now.Before(lot.Expires) {
+			break
+		}
+		expired += lot.Remaining
+	}
+	return expired, nil
+}
+
+func unexpiredBalance(tx *Tx, userID proto.UserID, now time.Time) (Cents, error) {
+	balance, err := getBalance(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := expiredPromo(tx, userID, now)
+	if err != nil {
+		return 0, err
+	}
+	if expired > balance {
+		expired = balance
+	}
+	if expired > 0 {
+		balance -= expired
+	}
+	return balance, nil
+}
+
+func savePromoLot(tx *Tx, userID proto.UserID, lot PromoLot) error {
+	ab, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+	b, err := ab.CreateBucketIfNotExists([]byte("promo"))
+	if err != nil {
+		return err
+	}
+	if lot.Remaining <= 0 {
+		return b.Delete([]byte(lot.TxID.String()))
+	}
+	encoded, err := json.Marshal(lot)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(lot.TxID.String()), encoded)
+}
+
+func deletePromoLot(tx *Tx, userID proto.UserID, txID snowflake.Snowflake) error {
+	b := promoBucket(tx, userID)
+	if b == nil {
+		return nil
+	}
+	return b.Delete([]byte(txID.String()))
+}
+
+func grantPromo(tx *Tx, cents Cents, userID proto.UserID, memo string, expiry time.Duration) error {
+	_, _, txID, err := transfer(tx, cents, House, userID, memo, true)
+	if err != nil {
+		return err
+	}
+	lot := PromoLot{
+		TxID:      txID,
+		Cents:     cents,
+		Remaining: cents,
+		Expires:   tx.db.Clock().Add(expiry),
+	}
+	return savePromoLot(tx, userID, lot)
+}
+
+func consumePromo(tx *Tx, userID proto.UserID, txID snowflake.Snowflake, cents Cents) error {
+	lots, err := promoLots(tx, userID)
+	if err != nil {
+		return err
+	}
+	uses := []promoUse{}
+	for _, lot := range lots {
+		if cents <= 0 {
+			break
+		}
+		used := lot.Remaining
+		if used > cents {
+			used = cents
+		}
+		lot.Remaining -= used
+		cents -= used
+		if err := savePromoLot(tx, userID, lot); err != nil {
+			return err
+		}
+		uses = append(uses, promoUse{Lot: lot.TxID, Cents: lot.Cents, Expires: lot.Expires, Used: used})
+	}
+	if len(uses) == 0 {
+		return nil
+	}
+
+	ab, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+	b, err := ab.CreateBucketIfNotExists([]byte("promoused"))
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(uses)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(txID.String()), encoded)
+}
+
+func restorePromo(tx *Tx, userID proto.UserID, txID snowflake.Snowflake) error {
+	ab := tx.AdvertiserBucket().Bucket([]byte(userID))
+	if ab == nil {
+		return nil
+	}
+	b := ab.Bucket([]byte("promoused"))
+	if b == nil {
+		return nil
+	}
+	encoded := b.Get([]byte(txID.String()))
+	if encoded == nil {
+		return nil
+	}
+	uses := []promoUse{}
+	if err := json.Unmarshal(encoded, &uses); err != nil {
+		return err
+	}
+
+	lots, err := promoLots(tx, userID)
+	if err != nil {
+		return err
+	}
+	current := map[snowflake.Snowflake]PromoLot{}
+	for _, lot := range lots {
+		current[lot.TxID] = lot
+	}
+	for _, use := range uses {
+		lot, ok := current[use.Lot]
+		if !ok {
+			lot = PromoLot{TxID: use.Lot, Cents: use.Cents, Expires: use.Expires}
+		}
+		lot.Remaining += use.Used
+		if err := savePromoLot(tx, userID, lot); err != nil {
+			return err
+		}
+		current[lot.TxID] = lot
+	}
+	return b.Delete([]byte(txID.String()))
+}
+
+func expirePromo(tx *Tx, userID proto.UserID, now time.Time) (Cents, error) {
+	lots, err := promoLots(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var expired Cents
+	for _, lot := range lots {
+		if now.Before(lot.Expires) {
+			break
+		}
+		balance, err := getBalance(tx, userID)
+		if err != nil {
+			return expired, err
+		}
+		amount := lot.Remaining
+		if amount > balance {
+			amount = balance
+		}
+		if amount > 0 {
+			memo := fmt.Sprintf("expired promotional credit from %s", lot.TxID)
+			if _, _, _, err := transfer(tx, amount, userID, House, memo, true); err != nil {
+				return expired, err
+			}
+			expired += amount
+		}
+		if err := deletePromoLot(tx, userID, lot.TxID); err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
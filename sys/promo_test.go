@@ -0,0 +1,98 @@
+package sys
+
+import (
+	"testing"
+	"time"
+
+	"euphoria.io/heim/proto/snowflake"
+)
+
+func TestPromoLots(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	db.Clock = func() time.Time { return now }
+
+	deposit := func(cents Cents) func() error {
+		return func() error {
+			_, _, err := Transfer(db, cents, House, "account:a", "", true)
+			return err
+		}
+	}
+	grant := func(cents Cents, expiry time.Duration) func() error {
+		return func() error {
+			return db.Update(func(tx *Tx) error { return grantPromo(tx, cents, "account:a", "", expiry) })
+		}
+	}
+	var charged snowflake.Snowflake
+	spend := func(cents Cents) func() error {
+		return func() error {
+			return db.Update(func(tx *Tx) error {
+				var err error
+				charged, err = charge(tx, cents, "account:a", "")
+				return err
+			})
+		}
+	}
+	refund := func() error {
+		_, _, err := Refund(db, charged.String(), "")
+		return err
+	}
+	give := func(cents Cents) func() error {
+		return func() error {
+			_, _, err := Transfer(db, cents, "account:a", "account:b", "", false)
+			return err
+		}
+	}
+	wait := func(d time.Duration) func() error {
+		return func() error {
+			now = now.Add(d)
+			return nil
+		}
+	}
+
+	cases := []struct {
+		name    string
+		op      func() error
+		err     error
+		balance Cents
+		lots    []Cents
+	}{
+		{"deposit", deposit(50), nil, 50, nil},
+		{"later lot", grant(100, 3*time.Hour), nil, 150, []Cents{100}},
+		{"earlier lot", grant(100, time.Hour), nil, 250, []Cents{100, 100}},
+		{"earliest expiry consumed first", spend(120), nil, 130, []Cents{80}},
+		{"promo not transferable", give(60), ErrInsufficientFunds, 130, []Cents{80}},
+		{"paid transferable", give(50), nil, 80, []Cents{80}},
+		{"before expiry", wait(2 * time.Hour), nil, 80, []Cents{80}},
+		{"expired before sweep", wait(2 * time.Hour), nil, 0, nil},
+		{"deposit after expiry", deposit(30), nil, 30, nil},
+		{"charge after expiry", spend(30), nil, 0, nil},
+		{"expired credit not chargeable", spend(1), ErrCreditLimit, 0, nil},
+		{"new lot", grant(100, time.Hour), nil, 100, []Cents{100}},
+		{"promo charge", spend(60), nil, 40, []Cents{40}},
+		{"refund restores lot", refund, nil, 100, []Cents{100}},
+		{"refunded credit still expires", wait(time.Hour), nil, 0, nil},
+	}
+	for _, tc := range cases {
+		if err := tc.op(); err != tc.err {
+			t.Fatalf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		adv, err := GetAdvertiser(db, "account:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adv.Balance != tc.balance {
+			t.Errorf("%s: balance %s, expected %s", tc.name, adv.Balance, tc.balance)
+		}
+		if len(adv.PromoLots) != len(tc.lots) {
+			t.Fatalf("%s: %d promo lots, expected %d", tc.name, len(adv.PromoLots), len(tc.lots))
+		}
+		for i, lot := range adv.PromoLots {
+			if lot.Remaining != tc.lots[i] {
+				t.Errorf("%s: lot %d has %s remaining, expected %s", tc.name, i, lot.Remaining, tc.lots[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+type ChargeRecord struct {
+	TxID     snowflake.Snowflake
+	Time     time.Time
+	UserID   proto.UserID
+	Spend    string
+	Creative string
+	Room     string
+	Keywords []string `json:",omitempty"`
+	Metrics  Metrics
+}
+
+func (c *ChargeRecord) save(tx *Tx) error {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return tx.ChargeBucket().Put([]byte(c.TxID.String()), encoded)
+}
+
+func loadChargeRecord(tx *Tx, txID string) (*ChargeRecord, error) {
+	encoded := tx.ChargeBucket().Get([]byte(txID))
+	if encoded == nil {
+		return nil, nil
+	}
+	c := &ChargeRecord{}
+	if err := json.Unmarshal(encoded, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *ChargeRecord) rollback(tx *Tx) error {
+	decr := (*Metrics).Decr
+	if err := saveMetrics(tx, c.UserID, c.Metrics, decr); err != nil {
+		return err
+	}
+	if c.Creative != "" {
+		if err := saveCreativeMetrics(tx, c.UserID, c.Creative, c.Metrics, decr); err != nil {
+			return err
+		}
+	}
+	key := SeriesKey{Hour: c.Time, UserID: c.UserID, Room: c.Room, Creative: c.Creative}
+	if err := adjustSeries(tx, key, c.Keywords, c.Metrics, true); err != nil {
+		return err
+	}
+
+	usage, err := loadBudgetUsage(tx, c.UserID, c.Spend, tx.db.Clock())
+	if err != nil {
+		return err
+	}
+	cost := Cents(c.Metrics.AmountSpent)
+	if usage.Day == budgetDay(c.Time) {
+		usage.Daily -= cost
+		if usage.Daily < 0 {
+			usage.Daily = 0
+		}
+	}
+	usage.Lifetime -= cost
+	if usage.Lifetime < 0 {
+		usage.Lifetime = 0
+	}
+	return saveBudgetUsage(tx, c.UserID, c.Spend, usage)
+}
+
+func findLedgerEntry(tx *Tx, txID string) (*LedgerEntry, error) {
+	ab := tx.AdvertiserBucket()
+	c := ab.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		b := ledgerBucket(tx, proto.UserID(k))
+		if b == nil {
+			continue
+		}
+		encoded := b.Get([]byte(txID))
+		if encoded == nil {
+			continue
+		}
+		entry := &LedgerEntry{}
+		if err := json.Unmarshal(encoded, entry); err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+	return nil, nil
+}
+
+func markRefund(tx *Tx, userID proto.UserID, refundID, origID snowflake.Snowflake) (*LedgerEntry, error) {
+	b := ledgerBucket(tx, userID)
+	key := []byte(refundID.String())
+	entry := &LedgerEntry{}
+	if err := json.Unmarshal(b.Get(key), entry); err != nil {
+		return nil, err
+	}
+	entry.Refunds = origID
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, b.Put(key, encoded)
+}
+
+func Refund(db *DB, txID, memo string) (refund *LedgerEntry, charge *ChargeRecord, err error) {
+	err = db.Update(func(tx *Tx) error {
+		if refundID := tx.RefundBucket().Get([]byte(txID)); refundID != nil {
+			return fmt.Errorf("%s was already refunded by %s", txID, refundID)
+		}
+		orig, err := findLedgerEntry(tx, txID)
+		if err != nil {
+			return err
+		}
+		if orig == nil {
+			return fmt.Errorf("no such transaction: %s", txID)
+		}
+		var none snowflake.Snowflake
+		if orig.Refunds != none {
+			return fmt.Errorf("%s is itself a refund of %s", txID, orig.Refunds)
+		}
+
+		if memo == "" {
+			memo = fmt.Sprintf("refund of %s", txID)
+		} else {
+			memo = fmt.Sprintf("refund of %s: %s", txID, memo)
+		}
+		_, _, refundID, err := transfer(tx, orig.Cents, orig.To, orig.From, memo, true)
+		if err != nil {
+			return err
+		}
+		if _, err := markRefund(tx, orig.To, refundID, orig.TxID); err != nil {
+			return err
+		}
+		if refund, err = markRefund(tx, orig.From, refundID, orig.TxID); err != nil {
+			return err
+		}
+		if err := tx.RefundBucket().Put([]byte(txID), []byte(refundID.String())); err != nil {
+			return err
+		}
+		if err := deletePromoLot(tx, orig.To, orig.TxID); err != nil {
+			return err
+		}
+		if err := restorePromo(tx, orig.From, orig.TxID); err != nil {
+			return err
+		}
+
+		if charge, err = loadChargeRecord(tx, txID); err != nil || charge == nil {
+			return err
+		}
+		return charge.rollback(tx)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return refund, charge, nil
+}
@@ -0,0 +1,67 @@
+package sys
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"euphoria.io/heim/proto/snowflake"
+)
+
+func TestRefund(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	var none, grantID, chargeID, refundID snowflake.Snowflake
+	err := db.Update(func(tx *Tx) error {
+		if _, _, _, err := transfer(tx, 50, House, "account:a", "", true); err != nil {
+			return err
+		}
+		if err := grantPromo(tx, 100, "account:a", "", time.Hour); err != nil {
+			return err
+		}
+		lots, err := promoLots(tx, "account:a")
+		if err != nil {
+			return err
+		}
+		grantID = lots[0].TxID
+		chargeID, err = charge(tx, 120, "account:a", "")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		txID    func() string
+		err     string
+		balance Cents
+		promo   Cents
+	}{
+		{"promo-funded charge", func() string { return chargeID.String() }, "", 150, 100},
+		{"double refund", func() string { return chargeID.String() }, "already refunded", 150, 100},
+		{"refund of a refund", func() string { return refundID.String() }, "is itself a refund", 150, 100},
+		{"unknown", func() string { return "nope" }, "no such transaction", 150, 100},
+		{"promo grant", func() string { return grantID.String() }, "", 50, 0},
+	}
+	for _, tc := range cases {
+		refund, _, err := Refund(db, tc.txID(), "")
+		switch {
+		case tc.err == "" && err != nil:
+			t.Fatalf("%s: %s", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Fatalf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+		if refund != nil && refundID == none {
+			refundID = refund.TxID
+		}
+		adv, err := GetAdvertiser(db, "account:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if adv.Balance != tc.balance || adv.Promo != tc.promo {
+			t.Errorf("%s: balance %s with %s promotional, expected %s with %s", tc.name, adv.Balance, adv.Promo, tc.balance, tc.promo)
+		}
+	}
+}
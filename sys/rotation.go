@@ -0,0 +1,73 @@
+package sys
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	WeightedRotation = "weighted"
+	BanditRotation   = "bandit"
+)
+
+type WeightedCreative struct {
+	Name   string
+	Weight float64
+}
+
+func (s *Spend) chooseCreative(tx *Tx, roomName string, now time.Time) (string, error) {
+	if len(s.Creatives) == 0 {
+		return s.CreativeName, nil
+	}
+	creatives, err := s.uncappedCreatives(tx, roomName, now)
+	if err != nil {
+		return "", err
+	}
+	if len(creatives) == 0 {
+		creatives = s.Creatives
+	}
+	if s.Rotation == BanditRotation {
+		return s.chooseCreativeByEngagement(tx, creatives)
+	}
+
+	total := float64(0)
+	for _, wc := range creatives {
+		total += wc.Weight
+	}
+	x := rand.Float64() * total
+	for _, wc := range creatives {
+		if x < wc.Weight {
+			return wc.Name, nil
+		}
+		x -= wc.Weight
+	}
+	return creatives[len(creatives)-1].Name, nil
+}
+
+func (s *Spend) chooseCreativeByEngagement(tx *Tx, creatives []WeightedCreative) (string, error) {
+	metrics := make([]Metrics, len(creatives))
+	total := float64(0)
+	for i, wc := range creatives {
+		m, err := loadCreativeMetrics(tx, s.UserID, wc.Name)
+		if err != nil {
+			return "", err
+		}
+		if m.AdsDisplayed == 0 {
+			return wc.Name, nil
+		}
+		metrics[i] = m
+		total += float64(m.AdsDisplayed)
+	}
+
+	best := ""
+	bestScore := float64(-1)
+	for i, wc := range creatives {
+		n := float64(metrics[i].AdsDisplayed)
+		score := float64(metrics[i].Engagements)/n + math.Sqrt(2*math.Log(total)/n)
+		if score > bestScore {
+			best, bestScore = wc.Name, score
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,171 @@
+package sys
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"euphoria.io/heim/proto"
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(name)
+	for i, weekday := range weekdayNames {
+		if strings.HasPrefix(name, weekday) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day: %s", name)
+}
+
+type Schedule [7]uint32
+
+func ParseSchedule(str string) (*Schedule, error) {
+	schedule := &Schedule{}
+	for _, part := range strings.Split(str, ",") {
+		fields := strings.SplitN(part, ":", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("expected DAYS:HOURS, e.g. mon-fri:9-17")
+		}
+
+		days := []time.Weekday{}
+		switch dayRange := strings.SplitN(fields[0], "-", 2); {
+		case fields[0] == "daily" || fields[0] == "*":
+			for d := 0; d < 7; d++ {
+				days = append(days, time.Weekday(d))
+			}
+		case len(dayRange) == 2:
+			first, err := parseWeekday(dayRange[0])
+			if err != nil {
+				return nil, err
+			}
+			last, err := parseWeekday(dayRange[1])
+			if err != nil {
+				return nil, err
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				days = append(days, d)
+				if d == last {
+					break
+				}
+			}
+		default:
+			day, err := parseWeekday(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			days = append(days, day)
+		}
+
+		for _, hourRange := range strings.Split(fields[1], "+") {
+			var first, last int
+			if _, err := fmt.Sscanf(hourRange, "%d-%d", &first, &last); err != nil {
+				return nil, fmt.Errorf("invalid hours: %s", hourRange)
+			}
+			if first < 0 || first > 23 || last < 0 || last > 24 || first == last {
+				return nil, fmt.Errorf("invalid hours: %s", hourRange)
+			}
+			for _, day := range days {
+				for h := first; h != last; h = (h + 1) % 24 {
+					if h < first {
+						schedule.Set((day+1)%7, h)
+					} else {
+						schedule.Set(day, h)
+					}
+					if h == 23 && last == 24 {
+						break
+					}
+				}
+			}
+		}
+	}
+	return schedule, nil
+}
+
+func (s *Schedule) Set(day time.Weekday, hour int) { s[day] |= 1 << uint(hour) }
+
+func (s Schedule) Active(t time.Time) bool { return s[t.Weekday()]&(1<<uint(t.Hour())) != 0 }
+
+func (s Schedule) String() string {
+	fmtHours := func(mask uint32) string {
+		ranges := []string{}
+		for h := 0; h < 24; h++ {
+			if mask&(1<<uint(h)) == 0 {
+				continue
+			}
+			start := h
+			for h+1 < 24 && mask&(1<<uint(h+1)) != 0 {
+				h++
+			}
+			ranges = append(ranges, fmt.Sprintf("%d-%d", start, h+1))
+		}
+		return strings.Join(ranges, "+")
+	}
+
+	parts := []string{}
+	for d := 0; d < 7; d++ {
+		if s[d] == 0 {
+			continue
+		}
+		start := d
+		for d+1 < 7 && s[d+1] == s[start] {
+			d++
+		}
+		days := weekdayNames[start]
+		if d > start {
+			days += "-" + weekdayNames[d]
+		}
+		parts = append(parts, days+":"+fmtHours(s[start]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *Spend) runningAt(now time.Time, loc *time.Location) (bool, string) {
+	if s.Start != nil && now.Before(*s.Start) {
+		return false, fmt.Sprintf("starts %s", s.Start.In(loc).Format("2006-01-02 15:04 MST"))
+	}
+	if s.End != nil && !now.Before(*s.End) {
+		return false, fmt.Sprintf("ended %s", s.End.In(loc).Format("2006-01-02 15:04 MST"))
+	}
+	if s.Schedule != nil && !s.Schedule.Active(now.In(loc)) {
+		return false, fmt.Sprintf("outside schedule %s (%s)", s.Schedule, loc)
+	}
+	return true, ""
+}
+
+func getLocation(tx *Tx, userID proto.UserID) (*time.Location, error) {
+	b := tx.AdvertiserBucket().Bucket([]byte(userID))
+	if b == nil {
+		return time.UTC, nil
+	}
+	name := b.Get([]byte("timezone"))
+	if name == nil {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(string(name))
+}
+
+func GetLocation(db *DB, userID proto.UserID) (loc *time.Location, err error) {
+	err = db.View(func(tx *Tx) error {
+		loc, err = getLocation(tx, userID)
+		return err
+	})
+	return
+}
+
+func SetTimeZone(db *DB, userID proto.UserID, name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.AdvertiserBucket().CreateBucketIfNotExists([]byte(userID))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("timezone"), []byte(loc.String()))
+	})
+	return loc, err
+}
@@ -0,0 +1,234 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"euphoria.io/heim/proto"
+)
+
+const (
+	ReportByHour       = "hour"
+	ReportByDay        = "day"
+	ReportByAdvertiser = "advertiser"
+	ReportByRoom       = "room"
+	ReportByCreative   = "creative"
+	ReportByKeyword    = "keyword"
+
+	seriesHourFormat = "2006-01-02T15"
+	seriesSep        = "\x00"
+)
+
+type SeriesKey struct {
+	Hour     time.Time
+	UserID   proto.UserID
+	Room     string
+	Creative string
+	Keyword  string
+}
+
+func (k SeriesKey) bytes() []byte {
+	return []byte(strings.Join([]string{
+		k.Hour.UTC().Format(seriesHourFormat), string(k.UserID), k.Room, k.Creative, k.Keyword}, seriesSep))
+}
+
+func parseSeriesKey(key []byte) (SeriesKey, error) {
+	parts := strings.Split(string(key), seriesSep)
+	if len(parts) != 5 {
+		return SeriesKey{}, fmt.Errorf("invalid series key: %q", key)
+	}
+	hour, err := time.Parse(seriesHourFormat, parts[0])
+	if err != nil {
+		return SeriesKey{}, err
+	}
+	return SeriesKey{
+		Hour:     hour,
+		UserID:   proto.UserID(parts[1]),
+		Room:     parts[2],
+		Creative: parts[3],
+		Keyword:  parts[4],
+	}, nil
+}
+
+func (k SeriesKey) group(by string) string {
+	switch by {
+	case ReportByHour:
+		return k.Hour.Format(seriesHourFormat)
+	case ReportByDay:
+		return k.Hour.Format("2006-01-02")
+	case ReportByAdvertiser:
+		return string(k.UserID)
+	case ReportByRoom:
+		return "&" + k.Room
+	case ReportByCreative:
+		return k.Creative
+	case ReportByKeyword:
+		return k.Keyword
+	default:
+		return "total"
+	}
+}
+
+func splitMetrics(m Metrics, current []Metrics, refund bool) []Metrics {
+	n := len(current)
+	parts := make([]Metrics, n)
+	split := func(field func(*Metrics) *uint64) {
+		x := *field(&m)
+		for i := range parts {
+			*field(&parts[i]) = x / uint64(n)
+		}
+		given := make([]bool, n)
+		for r := x % uint64(n); r > 0; r-- {
+			pick := -1
+			for i := range current {
+				if given[i] {
+					continue
+				}
+				if pick < 0 {
+					pick = i
+					continue
+				}
+				v, best := *field(&current[i]), *field(&current[pick])
+				if (!refund && v < best) || (refund && v > best) {
+					pick = i
+				}
+			}
+			given[pick] = true
+			*field(&parts[pick])++
+		}
+	}
+	split(func(m *Metrics) *uint64 { return &m.AdsDisplayed })
+	split(func(m *Metrics) *uint64 { return &m.Impressions })
+	split(func(m *Metrics) *uint64 { return &m.AmountSpent })
+	split(func(m *Metrics) *uint64 { return &m.AmountSpentByHouse })
+	split(func(m *Metrics) *uint64 { return &m.Engagements })
+	return parts
+}
+
+func recordSeries(tx *Tx, key SeriesKey, keywords []string, m Metrics) error {
+	return adjustSeries(tx, key, keywords, m, false)
+}
+
+func adjustSeries(tx *Tx, key SeriesKey, keywords []string, m Metrics, refund bool) error {
+	if key.UserID == House {
+		m.AmountSpentByHouse = m.AmountSpent
+	}
+	if len(keywords) == 0 {
+		keywords = []string{""}
+	}
+	keywords = append([]string(nil), keywords...)
+	sort.Strings(keywords)
+
+	b := tx.SeriesBucket()
+	current := make([]Metrics, len(keywords))
+	for i, keyword := range keywords {
+		key.Keyword = keyword
+		if err := current[i].Load(b, key.bytes()); err != nil {
+			return err
+		}
+	}
+
+	apply := (*Metrics).Incr
+	if refund {
+		apply = (*Metrics).Decr
+	}
+	for i, part := range splitMetrics(m, current, refund) {
+		key.Keyword = keywords[i]
+		if err := apply(&current[i], part).Save(b, key.bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ReportQuery struct {
+	By       string
+	Since    time.Time
+	Until    time.Time
+	UserID   proto.UserID
+	Room     string
+	Creative string
+	Keyword  string
+}
+
+func (q *ReportQuery) matches(key SeriesKey) bool {
+	if q.UserID != "" && key.UserID != q.UserID {
+		return false
+	}
+	if q.Room != "" && key.Room != q.Room {
+		return false
+	}
+	if q.Creative != "" && key.Creative != q.Creative {
+		return false
+	}
+	if q.Keyword != "" && key.Keyword != q.Keyword {
+		return false
+	}
+	return true
+}
+
+type ReportRow struct {
+	Group string
+	Metrics
+}
+
+func Report(db *DB, q ReportQuery) ([]ReportRow, error) {
+	groups := map[string]*Metrics{}
+	err := db.View(func(tx *Tx) error {
+		since := q.Since.UTC().Truncate(time.Hour)
+		prefix := []byte(since.Format(seriesHourFormat))
+		c := tx.SeriesBucket().Cursor()
+		for k, v := c.Seek(prefix); k != nil; k, v = c.Next() {
+			key, err := parseSeriesKey(k)
+			if err != nil {
+				return err
+			}
+			if !q.Until.IsZero() && !key.Hour.Before(q.Until) {
+				break
+			}
+			if !q.matches(key) {
+				continue
+			}
+			var m Metrics
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			group := key.group(q.By)
+			total, ok := groups[group]
+			if !ok {
+				total = &Metrics{}
+				groups[group] = total
+			}
+			total.Incr(m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]ReportRow, 0, len(groups))
+	for group, m := range groups {
+		rows = append(rows, ReportRow{Group: group, Metrics: *m})
+	}
+	sort.Sort(reportRows{rows, q.By == ReportByHour || q.By == ReportByDay})
+	return rows, nil
+}
+
+type reportRows struct {
+	rows          []ReportRow
+	chronological bool
+}
+
+func (rr reportRows) Len() int      { return len(rr.rows) }
+func (rr reportRows) Swap(i, j int) { rr.rows[i], rr.rows[j] = rr.rows[j], rr.rows[i] }
+
+func (rr reportRows) Less(i, j int) bool {
+	if rr.chronological || rr.rows[i].AmountSpent == rr.rows[j].AmountSpent {
+		return rr.rows[i].Group < rr.rows[j].Group
+	}
+	return rr.rows[i].AmountSpent > rr.rows[j].AmountSpent
+}
@@ -0,0 +1,48 @@
+package sys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesSplitsAcrossKeywords(t *testing.T) {
+	path := tempDBPath(t)
+	defer removeTestDB(path)
+	db := openTestDB(t, path)
+	defer db.Close()
+
+	hour := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	key := SeriesKey{Hour: hour, UserID: "account:abc", Room: "music", Creative: "foo"}
+	keywords := []string{"piano", "guitar", "drums"}
+	adjust := func(m Metrics, refund bool) {
+		err := db.Update(func(tx *Tx) error { return adjustSeries(tx, key, keywords, m, refund) })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		adjust(Metrics{AdsDisplayed: 1, Impressions: 4, AmountSpent: 10}, false)
+	}
+
+	rows, err := Report(db, ReportQuery{By: ReportByKeyword, Since: hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 keyword rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		if row.AdsDisplayed != 1 || row.Impressions != 4 || row.AmountSpent != 10 {
+			t.Errorf("%s: expected 1 ad, 4 impressions and 10 spent, got %+v", row.Group, row.Metrics)
+		}
+	}
+
+	adjust(Metrics{AdsDisplayed: 1, Impressions: 4, AmountSpent: 10}, true)
+	rows, err = Report(db, ReportQuery{Since: hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].AdsDisplayed != 2 || rows[0].Impressions != 8 || rows[0].AmountSpent != 20 {
+		t.Fatalf("unexpected total after refund: %+v", rows)
+	}
+}
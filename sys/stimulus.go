@@ -0,0 +1,207 @@
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+type StimulusSchedule struct {
+	ID     string
+	Amount Cents
+	Every  string
+	Expiry time.Duration `json:",omitempty"`
+	Next   time.Time
+}
+
+func (s *StimulusSchedule) String() string {
+	str := fmt.Sprintf("%s every %s", s.Amount, s.Every)
+	if s.Expiry > 0 {
+		str += fmt.Sprintf(", expiring after %s", s.Expiry)
+	}
+	return str
+}
+
+func (s *StimulusSchedule) next(after time.Time) time.Time {
+	after = after.UTC()
+	t := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, time.UTC)
+	for {
+		t = t.AddDate(0, 0, 1)
+		if s.Every == "day" || weekdayNames[t.Weekday()] == s.Every {
+			return t
+		}
+	}
+}
+
+func ParseStimulusEvery(str string) (string, error) {
+	str = strings.ToLower(str)
+	if str == "day" || str == "daily" {
+		return "day", nil
+	}
+	day, err := parseWeekday(str)
+	if err != nil {
+		return "", err
+	}
+	return weekdayNames[day], nil
+}
+
+func advertiserIDs(tx *Tx) []proto.UserID {
+	userIDs := []proto.UserID{}
+	c := tx.AdvertiserBucket().Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		userID := proto.UserID(k)
+		if kind, _ := userID.Parse(); v != nil || kind == "" {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+func stimulate(tx *Tx, amount Cents, expiry time.Duration, memo string) error {
+	if expiry <= 0 {
+		b := tx.StimulusBucket()
+		former := Cents(0)
+		if bs := b.Get([]byte("stimulus")); bs != nil {
+			c, err := strconv.ParseInt(string(bs), 10, 64)
+			if err != nil {
+				return err
+			}
+			former = Cents(c)
+		}
+		if err := b.Put([]byte("stimulus"), []byte(fmt.Sprintf("%d", former+amount))); err != nil {
+			return err
+		}
+	}
+	for _, userID := range advertiserIDs(tx) {
+		if expiry > 0 {
+			if err := grantPromo(tx, amount, userID, memo, expiry); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, _, _, err := transfer(tx, amount, House, userID, memo, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ScheduleStimulus(db *DB, amount Cents, every string, expiry time.Duration) (*StimulusSchedule, error) {
+	id, err := snowflake.New()
+	if err != nil {
+		return nil, err
+	}
+	s := &StimulusSchedule{
+		ID:     id.String(),
+		Amount: amount,
+		Every:  every,
+		Expiry: expiry,
+	}
+	s.Next = s.next(db.Clock())
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *Tx) error {
+		b, err := tx.StimulusBucket().CreateBucketIfNotExists([]byte("schedule"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(s.ID), encoded)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func stimulusSchedules(tx *Tx) ([]StimulusSchedule, error) {
+	schedules := []StimulusSchedule{}
+	b := tx.StimulusBucket().Bucket([]byte("schedule"))
+	if b == nil {
+		return schedules, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		s := StimulusSchedule{}
+		if err := json.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		schedules = append(schedules, s)
+		return nil
+	})
+	return schedules, err
+}
+
+func StimulusSchedules(db *DB) (schedules []StimulusSchedule, err error) {
+	err = db.View(func(tx *Tx) error {
+		schedules, err = stimulusSchedules(tx)
+		return err
+	})
+	sort.Sort(schedulesByNext(schedules))
+	return
+}
+
+func CancelStimulus(db *DB, id string) (cancelled bool, err error) {
+	err = db.Update(func(tx *Tx) error {
+		b := tx.StimulusBucket().Bucket([]byte("schedule"))
+		if b == nil || b.Get([]byte(id)) == nil {
+			return nil
+		}
+		cancelled = true
+		return b.Delete([]byte(id))
+	})
+	return
+}
+
+func RunStimulus(db *DB) (ran []StimulusSchedule, err error) {
+	now := db.Clock()
+	err = db.Update(func(tx *Tx) error {
+		schedules, err := stimulusSchedules(tx)
+		if err != nil {
+			return err
+		}
+		b := tx.StimulusBucket().Bucket([]byte("schedule"))
+		for _, s := range schedules {
+			if now.Before(s.Next) {
+				continue
+			}
+			memo := fmt.Sprintf("euphoria commercial speech stimulus (every %s)", s.Every)
+			if s.Expiry > 0 {
+				memo = fmt.Sprintf("euphoria commercial speech stimulus (every %s, promotional)", s.Every)
+			}
+			if err := stimulate(tx, s.Amount, s.Expiry, memo); err != nil {
+				return err
+			}
+			s.Next = s.next(now)
+			encoded, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(s.ID), encoded); err != nil {
+				return err
+			}
+			ran = append(ran, s)
+		}
+
+		for _, userID := range advertiserIDs(tx) {
+			if _, err := expirePromo(tx, userID, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+type schedulesByNext []StimulusSchedule
+
+func (ss schedulesByNext) Len() int           { return len(ss) }
+func (ss schedulesByNext) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
+func (ss schedulesByNext) Less(i, j int) bool { return ss[i].Next.Before(ss[j].Next) }
@@ -0,0 +1,56 @@
+package sys
+
+import (
+	"testing"
+	"time"
+
+	"euphoria.io/heim/proto"
+)
+
+func TestStimulusCreditsNewAdvertisers(t *testing.T) {
+	cases := []struct {
+		name     string
+		expiry   time.Duration
+		existing Cents
+		newcomer Cents
+	}{
+		{"recurring", 0, 150, 50},
+		{"promotional", 24 * time.Hour, 150, 0},
+	}
+	for _, tc := range cases {
+		db, cleanup := newTestDB(t)
+
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		db.Clock = func() time.Time { return now }
+		if _, _, err := Transfer(db, 100, House, "account:old", "", true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ScheduleStimulus(db, 50, "day", tc.expiry); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(24 * time.Hour)
+		if ran, err := RunStimulus(db); err != nil || len(ran) != 1 {
+			t.Fatalf("%s: ran %d schedules: %v", tc.name, len(ran), err)
+		}
+
+		balance := func(userID proto.UserID) (cents Cents) {
+			err := db.Update(func(tx *Tx) error {
+				var err error
+				cents, err = getBalance(tx, userID)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		if cents := balance("account:old"); cents != tc.existing {
+			t.Errorf("%s: existing advertiser has %s, expected %s", tc.name, cents, tc.existing)
+		}
+		if cents := balance("account:new"); cents != tc.newcomer {
+			t.Errorf("%s: new advertiser has %s, expected %s", tc.name, cents, tc.newcomer)
+		}
+
+		cleanup()
+	}
+}
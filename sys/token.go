@@ -0,0 +1,115 @@
+package sys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"euphoria.io/heim/proto"
+	"euphoria.io/heim/proto/snowflake"
+)
+
+const tokenPrefix = "adbot_"
+
+type APIToken struct {
+	ID      string
+	UserID  proto.UserID
+	Name    string `json:",omitempty"`
+	Created time.Time
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+func CreateToken(db *DB, userID proto.UserID, name string) (string, *APIToken, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	id, err := snowflake.New()
+	if err != nil {
+		return "", nil, err
+	}
+	token := tokenPrefix + hex.EncodeToString(secret)
+	t := &APIToken{
+		ID:      id.String(),
+		UserID:  userID,
+		Name:    name,
+		Created: db.Clock(),
+	}
+	encoded, err := json.Marshal(t)
+	if err != nil {
+		return "", nil, err
+	}
+	err = db.Update(func(tx *Tx) error { return tx.TokenBucket().Put(hashToken(token), encoded) })
+	if err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+func LookupToken(db *DB, token string) (t *APIToken, err error) {
+	err = db.View(func(tx *Tx) error {
+		encoded := tx.TokenBucket().Get(hashToken(token))
+		if encoded == nil {
+			return nil
+		}
+		t = &APIToken{}
+		return json.Unmarshal(encoded, t)
+	})
+	return
+}
+
+func mapTokens(tx *Tx, userID proto.UserID, f func(k []byte, t APIToken) error) error {
+	return tx.TokenBucket().ForEach(func(k, v []byte) error {
+		t := APIToken{}
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		if t.UserID != userID {
+			return nil
+		}
+		return f(k, t)
+	})
+}
+
+func Tokens(db *DB, userID proto.UserID) ([]APIToken, error) {
+	tokens := []APIToken{}
+	err := db.View(func(tx *Tx) error {
+		return mapTokens(tx, userID, func(k []byte, t APIToken) error {
+			tokens = append(tokens, t)
+			return nil
+		})
+	})
+	sort.Sort(tokensByCreated(tokens))
+	return tokens, err
+}
+
+func RevokeToken(db *DB, userID proto.UserID, id string) (revoked bool, err error) {
+	err = db.Update(func(tx *Tx) error {
+		var key []byte
+		err := mapTokens(tx, userID, func(k []byte, t APIToken) error {
+			if t.ID == id {
+				key = append([]byte(nil), k...)
+			}
+			return nil
+		})
+		if err != nil || key == nil {
+			return err
+		}
+		revoked = true
+		return tx.TokenBucket().Delete(key)
+	})
+	return
+}
+
+type tokensByCreated []APIToken
+
+func (ts tokensByCreated) Len() int           { return len(ts) }
+func (ts tokensByCreated) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
+func (ts tokensByCreated) Less(i, j int) bool { return ts[i].Created.Before(ts[j].Created) }